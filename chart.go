@@ -0,0 +1,452 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Legend maps stitches onto the symbols representing them in text
+// charts. Stitches are written as they appear in patterns, including
+// any modifiers. E.g.: `K`, `K2Tog` or `@K` for a knit stitch through
+// the back loop. Keys are case insensitive.
+type Legend map[string]rune
+
+// NewLegend creates a legend holding the chart symbols of all stitches
+// in the given registry. If it is nil, the builtin stitches are used.
+func NewLegend(r *Registry) Legend {
+	if r == nil {
+		r = builtin
+	}
+
+	l := make(Legend)
+
+	for _, def := range r.Defs() {
+		if def.Symbol != 0 {
+			l[def.Name] = def.Symbol
+		}
+	}
+
+	return l
+}
+
+// symbols returns the legend keyed by lower case stitch name, and keyed
+// by symbol. Returns an error if the legend is ambiguous or uses symbols
+// which clash with the chart layout.
+func (l Legend) symbols() (map[string]rune, map[rune]string, error) {
+	byName := make(map[string]rune, len(l))
+	bySymbol := make(map[rune]string, len(l))
+
+	for name, sym := range l {
+		if unicode.IsSpace(sym) || unicode.IsDigit(sym) {
+			return nil, nil, fmt.Errorf("Invalid chart symbol %q for %s.", sym, name)
+		}
+
+		if other, ok := bySymbol[sym]; ok {
+			return nil, nil, fmt.Errorf("Chart symbol %q is used for both %s and %s.", sym, other, name)
+		}
+
+		byName[strings.ToLower(name)] = sym
+		bySymbol[sym] = name
+	}
+
+	return byName, bySymbol, nil
+}
+
+// Chart renders the pattern as a text chart, using one symbol per
+// stitch from the given legend. If the legend is nil, the symbols of
+// the builtin stitches are used. A stitch with modifiers, which has no
+// symbol of its own, is drawn with the symbol of its plain stitch. E.g.:
+// `@K` is drawn as `K`.
+//
+// The chart shows the right side of the work, as returned by
+// Pattern.PublicSide. The first row is at the bottom. Every row is read
+// in the direction it is worked: right side rows and rounds from right
+// to left and wrong side rows from left to right. This is indicated by
+// the row numbers, which are written on the side the row starts at.
+// Rows are aligned at the right edge of the chart. For example:
+//
+//	  |-|-|-| 3
+//	2 -|-|-|-
+//	  |-|-|-| 1
+//
+// A chart in which every row is numbered on the right is read as rounds
+// by ParseChart. Rows which can not be told apart from rounds that way
+// get a `Row` or `Rnd` label before their number.
+//
+// Colours, markers and turns are not shown. Pattern.ChartSVG does show
+// colours.
+func (p *Pattern) Chart(l Legend) (string, error) {
+	rows, width, err := p.chartRows(l)
+
+	if err != nil {
+		return "", err
+	}
+
+	var numWidth int
+
+	for _, row := range rows {
+		if len(row.num) > numWidth {
+			numWidth = len(row.num)
+		}
+	}
+
+	out := make([]string, len(rows))
+
+	for i, row := range rows {
+		left, right := strings.Repeat(" ", numWidth), ""
+
+		if row.left {
+			left = fmt.Sprintf("%*s", numWidth, row.num)
+		} else if len(row.label) > 0 {
+			right = row.label + " " + row.num
+		} else {
+			right = row.num
+		}
+
+		cells := strings.Repeat(" ", width-len(row.cells)) + string(row.cells)
+		out[i] = strings.TrimRight(left+" "+cells+" "+right, " ")
+	}
+
+	return strings.Join(out, "\n"), nil
+}
+
+// ChartSVG renders the pattern as an SVG image of its chart. The layout
+// is the same as for Pattern.Chart: each stitch is drawn as a square
+// holding its symbol. The square is filled with the value of the
+// stitch's colour in the pattern's palette, so the palette should use
+// SVG colours, like `navy` or `#1f3a5f`. Stitches without a declared
+// colour are left blank. Row numbers are drawn without labels.
+func (p *Pattern) ChartSVG(l Legend) (string, error) {
+	const cell = 20
+
+	rows, width, err := p.chartRows(l)
+
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+
+	w, h := (width+4)*cell, len(rows)*cell
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", w, h, w, h)
+	fmt.Fprintf(&sb, `<g font-family="monospace" font-size="%d" text-anchor="middle" dominant-baseline="central">`+"\n", cell*3/4)
+
+	for i, row := range rows {
+		y := i * cell
+		x0 := (2 + width - len(row.cells)) * cell
+
+		for k, sym := range row.cells {
+			x := x0 + k*cell
+			fill := "none"
+
+			if len(row.fills[k]) > 0 {
+				fill = html.EscapeString(row.fills[k])
+			}
+
+			fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="black"/>`, x, y, cell, cell, fill)
+			fmt.Fprintf(&sb, `<text x="%d" y="%d">%s</text>`+"\n", x+cell/2, y+cell/2, html.EscapeString(string(sym)))
+		}
+
+		x := (width+3)*cell + cell/2
+
+		if row.left {
+			x = cell
+		}
+
+		fmt.Fprintf(&sb, `<text x="%d" y="%d">%s</text>`+"\n", x, y+cell/2, row.num)
+	}
+
+	sb.WriteString("</g>\n</svg>\n")
+	return sb.String(), nil
+}
+
+// chartLine is a single line of a chart.
+type chartLine struct {
+	cells []rune   // Symbols, from left to right.
+	fills []string // Palette value of every cell. Empty if it has none.
+	num   string   // Row number.
+	label string   // `Row` or `Rnd` if the number needs a label.
+	left  bool     // Is the number written on the left?
+}
+
+// chartRows returns the lines of the chart for the pattern, from the top
+// down, along with the number of cells in the widest line.
+func (p *Pattern) chartRows(l Legend) ([]*chartLine, int, error) {
+	if l == nil {
+		l = NewLegend(nil)
+	}
+
+	byName, _, err := l.symbols()
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("Chart %q: %v", p.Name, err)
+	}
+
+	q, err := p.Unrolled()
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("Chart %q: %v", p.Name, err)
+	}
+
+	var width int
+
+	rows := q.PublicSide().Rows()
+	out := make([]*chartLine, len(rows))
+
+	// Rounds are only told apart from right side rows by their labels,
+	// unless every row is numbered on the right.
+	allRight := true
+
+	for _, row := range rows {
+		allRight = allRight && row.Side != WrongSide
+	}
+
+	for i, row := range rows {
+		var cells []rune
+		var fills []string
+
+		for _, node := range row.Nodes {
+			st, ok := node.(*Stitch)
+
+			if !ok {
+				continue
+			}
+
+			sym, ok := byName[strings.ToLower(st.String())]
+
+			if !ok {
+				sym, ok = byName[strings.ToLower(st.Name())]
+			}
+
+			if !ok {
+				return nil, 0, fmt.Errorf("Chart %q: %d:%d No chart symbol for %s.",
+					p.Name, st.line, st.col, st)
+			}
+
+			// The first stitch is worked at the right edge.
+			cells = append([]rune{sym}, cells...)
+			fills = append([]string{""}, fills...)
+
+			if c := p.Color(st.Color); c != nil {
+				fills[0] = c.Value
+			}
+		}
+
+		num := i + 1
+
+		if row.Row != nil && row.Row.Value > 0 {
+			num = row.Row.Value
+		}
+
+		if len(cells) > width {
+			width = len(cells)
+		}
+
+		line := &chartLine{cells, fills, strconv.Itoa(num), "", row.Side == WrongSide}
+		round := row.Row != nil && row.Row.Round
+
+		switch {
+		case line.left:
+		case allRight && !round:
+			line.label = "Row"
+		case !allRight && round:
+			line.label = "Rnd"
+		}
+
+		// The first row goes at the bottom.
+		out[len(rows)-1-i] = line
+	}
+
+	return out, width, nil
+}
+
+// ParseChart parses a text chart, as produced by Pattern.Chart, into a
+// pattern. If the legend is nil, the symbols of the builtin stitches are
+// used. The stitch names in the legend are resolved with the builtin
+// stitches. Use Parser.ParseChart for custom stitches.
+func ParseChart(name, chart string, l Legend) (*Pattern, error) {
+	return new(Parser).ParseChart(name, chart, l)
+}
+
+// ParseChart parses a text chart, as produced by Pattern.Chart, into a
+// pattern. If the legend is nil, the symbols of the parser's stitches
+// are used. Blank lines are ignored. Every other line must hold a row
+// number, either before or after its symbols.
+//
+// A row numbered on the left is a wrong side row. If every row is
+// numbered on the right, they are rounds. Otherwise, a row numbered on
+// the right is a right side row. A `Row` or `Rnd` label before a number
+// on the right explicitly makes it a right side row or a round. Sides
+// are only annotated on rows which do not alternate as usual.
+//
+// The resulting nodes refer to their position in the chart.
+func (ps *Parser) ParseChart(name, chart string, l Legend) (*Pattern, error) {
+	type chartRow struct {
+		num   int
+		left  bool
+		label string
+		cells []Node
+		line  int
+		col   int
+	}
+
+	reg := ps.Stitches
+
+	if reg == nil {
+		reg = builtin
+	}
+
+	if l == nil {
+		l = NewLegend(reg)
+	}
+
+	_, bySymbol, err := l.symbols()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	var rows []*chartRow
+
+	lines := strings.Split(chart, "\n")
+
+	for i, line := range lines {
+		f := strings.Fields(line)
+
+		if len(f) == 0 {
+			continue
+		}
+
+		row := &chartRow{line: i + 1, col: strings.IndexFunc(line, isNotSpace) + 1}
+
+		if n, err := strconv.Atoi(f[0]); err == nil {
+			row.num, row.left = n, true
+			f = f[1:]
+		} else if n, err := strconv.Atoi(f[len(f)-1]); err == nil {
+			row.num = n
+			f = f[:len(f)-1]
+
+			// Symbols never hold spaces, so a second field is a label.
+			// A label on its own denotes an empty row.
+			if len(f) == 2 || (len(f) == 1 && isChartLabel(f[0])) {
+				row.label = strings.ToLower(f[len(f)-1])
+				f = f[:len(f)-1]
+
+				if !isChartLabel(row.label) {
+					return nil, fmt.Errorf("%s:%d:%d Unknown row label %q,",
+						name, row.line, row.col, row.label)
+				}
+			}
+		} else {
+			return nil, fmt.Errorf("%s:%d:%d Expected row number,", name, row.line, row.col)
+		}
+
+		if len(f) > 1 {
+			return nil, fmt.Errorf("%s:%d:%d Unexpected space between chart symbols,",
+				name, row.line, row.col)
+		}
+
+		if len(f) == 1 {
+			col := strings.Index(line, f[0])
+
+			for k, sym := range f[0] {
+				pos := utf8.RuneCountInString(line[:col+k]) + 1
+				st, err := chartStitch(reg, bySymbol, sym, i+1, pos)
+
+				if err != nil {
+					return nil, fmt.Errorf("%s:%v,", name, err)
+				}
+
+				// The cells are read from right to left.
+				row.cells = append([]Node{st}, row.cells...)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	allRight := true
+
+	for _, cr := range rows {
+		allRight = allRight && !cr.left
+	}
+
+	p := &Pattern{Name: name, Group: new(Group), reg: reg}
+	side := WrongSide
+
+	// The first row of the chart is the last one worked.
+	for i := len(rows) - 1; i >= 0; i-- {
+		cr := rows[i]
+		r := &Row{Value: cr.num, line: cr.line, col: cr.col}
+
+		switch {
+		case cr.left:
+			r.Side = WrongSide
+		case cr.label == "rnd" || (allRight && len(cr.label) == 0):
+			r.Round = true
+		default:
+			r.Side = RightSide
+		}
+
+		if !r.Round && r.Side == side.Opposite() {
+			r.Side = UnknownSide
+		}
+
+		side = RightSide
+
+		if !r.Round && cr.left {
+			side = WrongSide
+		}
+
+		p.Append(r)
+		p.Append(cr.cells...)
+	}
+
+	// The chart shows wrong side rows as they appear from the right
+	// side. Flipping them again yields the order they are worked in.
+	return p.PublicSide(), nil
+}
+
+// chartStitch returns the stitch for the given chart symbol.
+func chartStitch(reg *Registry, bySymbol map[rune]string, sym rune, line, col int) (*Stitch, error) {
+	name, ok := bySymbol[sym]
+
+	if !ok {
+		return nil, fmt.Errorf("%d:%d Unknown chart symbol %q", line, col, sym)
+	}
+
+	st := &Stitch{line: line, col: col}
+
+	for len(name) > 0 && isMod(name[0]) {
+		st.Mod |= getModKind(name[:1])
+		name = name[1:]
+	}
+
+	def := reg.Lookup(name)
+
+	if def == nil {
+		return nil, fmt.Errorf("%d:%d Unknown stitch %q for chart symbol %q", line, col, name, sym)
+	}
+
+	st.Kind = def.Kind
+
+	if def.Custom() {
+		st.Def = def
+	}
+
+	return st, nil
+}
+
+// isChartLabel returns true if v labels a row number in a chart.
+func isChartLabel(v string) bool {
+	return strings.EqualFold(v, "row") || strings.EqualFold(v, "rnd")
+}
+
+func isNotSpace(r rune) bool { return !unicode.IsSpace(r) }
@@ -0,0 +1,135 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChart(t *testing.T) {
+	p := MustParse("Lace", `Row 1: K2 [Yo K2Tog] 2 P2
+		Row 2: K2 P6
+		Row 3: Ssk K4 P2
+		Row 4: K8`)
+
+	chart, err := p.Chart(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `4 --------
+   --||||\ 3
+2 --||||||
+  --/o/o|| 1`
+
+	if chart != want {
+		t.Fatalf("Chart:\nWant:\n%s\nHave:\n%s", want, chart)
+	}
+
+	q, err := ParseChart("Lace", chart, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Unroll()
+
+	if want, have := p.String(), q.String(); want != have {
+		t.Fatalf("Round trip:\nWant: %s\nHave: %s", want, have)
+	}
+
+	if _, err := ParseChart("Rounds", "|-|- 2\n-|-| 1", Legend{"K": 'x', "P": '.'}); err == nil {
+		t.Fatal("Expected error for unknown chart symbol")
+	}
+
+	rounds, err := ParseChart("Rounds", "x.x. 2\n.x.x 1", Legend{"K": 'x', "P": '.'})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := "Rnd1: K P K P \nRnd2: P K P K", rounds.String(); want != have {
+		t.Fatalf("Rounds:\nWant: %q\nHave: %q", want, have)
+	}
+
+	// Flat rows and rounds are told apart by their labels, unless every
+	// row is numbered on the right.
+	for src, want := range map[string]string{
+		"Row 1 RS: K2\nRow 3 RS: P2":      "  -- Row 3\n  || Row 1",
+		"Rnd 1: K2":                       "  || 1",
+		"Row 1: K2\nRow 2: P2\nRnd 3: K2": "  || Rnd 3\n2 ||\n  || 1",
+	} {
+		p := MustParse("Labels", src)
+
+		chart, err := p.Chart(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if chart != want {
+			t.Fatalf("Chart %q:\nWant:\n%s\nHave:\n%s", src, want, chart)
+		}
+
+		q, err := ParseChart("Labels", chart, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, row := range q.Rows() {
+			if a := p.Rows()[i].Row; row.Row.Round != a.Round || row.Side != p.Rows()[i].Side {
+				t.Fatalf("Chart %q: Row %d: Want round %v on %s, have round %v on %s",
+					src, i+1, a.Round, p.Rows()[i].Side, row.Row.Round, row.Side)
+			}
+		}
+	}
+
+	if _, err := ParseChart("Ambiguous", "|| 1", Legend{"K": '|', "P": '|'}); err == nil {
+		t.Fatal("Expected error for ambiguous legend")
+	}
+
+	if _, err := MustParse("Unknown", "Row 1: K2 P").Chart(Legend{"K": '|'}); err == nil {
+		t.Fatal("Expected error for stitch without symbol")
+	}
+
+	// Modified stitches fall back to the symbol of the plain stitch.
+	chart, err = MustParse("Modified", "Row 1: K2 ^K @P").Chart(Legend{"K": '|', "P": '-', "@P": 'x'})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "  x||| Row 1"; chart != want {
+		t.Fatalf("Chart:\nWant: %s\nHave: %s", want, chart)
+	}
+}
+
+func TestChartSVG(t *testing.T) {
+	p := MustParse("Lace", `Row 1: K2 [Yo K2Tog] 2 P2
+		Row 2: K2 P6
+		Row 3: Ssk K4 P2
+		Row 4: K8`)
+
+	svg, err := p.ChartSVG(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(svg, "<rect "); n != 31 {
+		t.Fatalf("Want 31 chart cells, have %d", n)
+	}
+
+	// Cells are filled with their palette colour.
+	svg, err = MustParse("Stripes", "{MC: white} {CC: #1f3a5f}\nRow 1: {MC} K2 {CC} K\nRow 2: P3").ChartSVG(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for fill, want := range map[string]int{"white": 2, "#1f3a5f": 4, "none": 0} {
+		if n := strings.Count(svg, `fill="`+fill+`"`); n != want {
+			t.Fatalf("Want %d cells filled with %s, have %d:\n%s", want, fill, n, svg)
+		}
+	}
+
+	if _, err := MustParse("Unknown", "Row 1: K2 P").ChartSVG(Legend{"K": '|'}); err == nil {
+		t.Fatal("Expected error for stitch without symbol")
+	}
+}
@@ -0,0 +1,216 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jteeuwen/knit"
+)
+
+// runParse prints the parse tree of the pattern.
+func runParse(c *context, p *knit.Pattern) error {
+	if c.json {
+		return c.writeJSON(p)
+	}
+
+	if p.Len() == 0 {
+		fmt.Fprintf(c.stdout, "Pattern %q: <empty>\n", p.Name)
+		return nil
+	}
+
+	fmt.Fprintf(c.stdout, "Pattern %q:\n", p.Name)
+	dumpNodes(c.stdout, p.Nodes(), " ")
+	return nil
+}
+
+// dumpNodes recursively writes nodes out to the given writer in
+// a human-readable form.
+func dumpNodes(w io.Writer, list []knit.Node, indent string) {
+	for _, node := range list {
+		switch tt := node.(type) {
+		case *knit.Group:
+			fmt.Fprintf(w, "%s%03d:%03d %T {\n", indent, tt.Line(), tt.Col(), tt)
+			dumpNodes(w, tt.Nodes(), indent+"  ")
+			fmt.Fprintf(w, "%s}\n", indent)
+
+		case *knit.Number:
+			fmt.Fprintf(w, "%s%03d:%03d %T(%d)\n", indent, tt.Line(), tt.Col(), tt, tt.Value)
+
+		case *knit.Reference:
+			fmt.Fprintf(w, "%s%03d:%03d %T(%q)\n", indent, tt.Line(), tt.Col(), tt, tt.Name)
+
+		case fmt.Stringer:
+			fmt.Fprintf(w, "%s%03d:%03d %T(%q)\n", indent, node.Line(), node.Col(), tt, tt)
+
+		default:
+			fmt.Fprintf(w, "%s%03d:%03d %T\n", indent, node.Line(), node.Col(), tt)
+		}
+	}
+}
+
+// runExpand prints the pattern with all references expanded.
+func runExpand(c *context, p *knit.Pattern) error {
+	if len(c.lib) == 0 {
+		return errUsage
+	}
+
+	return c.writePattern(p)
+}
+
+// runUnroll prints the unrolled pattern.
+func runUnroll(c *context, p *knit.Pattern) error {
+	q, err := p.Unrolled()
+
+	if err != nil {
+		return err
+	}
+
+	return c.writePattern(q)
+}
+
+// jsonCount is the JSON form of the stitch counts of a row.
+type jsonCount struct {
+	Row    int `json:"row"`
+	Line   int `json:"line"`
+	Col    int `json:"col"`
+	Before int `json:"before"`
+	After  int `json:"after"`
+	Worked int `json:"worked"`
+	Held   int `json:"held"`
+}
+
+// jsonCountError is the JSON form of a stitch count error.
+type jsonCountError struct {
+	Row  int    `json:"row"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
+	Msg  string `json:"msg"`
+}
+
+// runCount prints the stitch counts of every row. Inconsistencies are
+// printed as well and make the command fail.
+func runCount(c *context, p *knit.Pattern) error {
+	counts, err := p.StitchCounts()
+
+	if counts == nil {
+		return err
+	}
+
+	errs, _ := err.(knit.CountErrors)
+
+	if c.json {
+		out := struct {
+			Rows   []*jsonCount      `json:"rows"`
+			Errors []*jsonCountError `json:"errors"`
+		}{}
+
+		for _, ce := range errs {
+			out.Errors = append(out.Errors, &jsonCountError{ce.Row, ce.Line, ce.Col, ce.Msg})
+		}
+
+		for i, rc := range counts {
+			jc := &jsonCount{Row: rowNumber(rc.Row, i), Before: rc.Before,
+				After: rc.After, Worked: rc.Worked, Held: rc.Held}
+
+			if r := rc.Row.Row; r != nil {
+				jc.Line, jc.Col = r.Line(), r.Col()
+			}
+
+			out.Rows = append(out.Rows, jc)
+		}
+
+		if err := c.writeJSON(out); err != nil {
+			return err
+		}
+	} else {
+		for i, rc := range counts {
+			s := fmt.Sprintf("Row %d: %d sts", rowNumber(rc.Row, i), rc.After)
+
+			if rc.Held > 0 {
+				s += fmt.Sprintf(", %d held", rc.Held)
+			}
+
+			fmt.Fprintln(c.stdout, s)
+		}
+	}
+
+	if len(errs) > 0 {
+		err = fmt.Errorf("%s: %d stitch count errors:\n%v", p.Name, len(errs), errs)
+
+		if c.json {
+			err = reportedError{err}
+		}
+	}
+
+	return err
+}
+
+// rowNumber returns the number of the row at index i.
+func rowNumber(row *knit.RowData, i int) int {
+	if row.Row != nil && row.Row.Value > 0 {
+		return row.Row.Value
+	}
+
+	return i + 1
+}
+
+// runChart prints the chart of the pattern.
+func runChart(c *context, p *knit.Pattern) error {
+	var chart string
+	var err error
+
+	if c.svg {
+		chart, err = p.ChartSVG(nil)
+	} else {
+		chart, err = p.Chart(nil)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.writeJSON(map[string]string{"name": p.Name, "chart": chart})
+	}
+
+	_, err = fmt.Fprintln(c.stdout, strings.TrimSuffix(chart, "\n"))
+	return err
+}
+
+// runConvert writes the pattern in the format given by -to.
+func runConvert(c *context, p *knit.Pattern) error {
+	switch c.to {
+	case "knit":
+		_, err := fmt.Fprintln(c.stdout, p)
+		return err
+
+	case "json":
+		return c.writeJSON(p)
+
+	case "knitml":
+		issues, err := p.WriteKnitML(c.stdout)
+
+		for _, is := range issues {
+			fmt.Fprintf(c.stderr, "%s:%s\n", p.Name, is)
+		}
+
+		return err
+
+	case "chart":
+		c.svg = false
+		return runChart(c, p)
+
+	case "svg":
+		c.svg = true
+		return runChart(c, p)
+
+	case "":
+		return errUsage
+	}
+
+	return fmt.Errorf("unknown output format %q", c.to)
+}
@@ -0,0 +1,371 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+/*
+Command knit reads, checks and converts knitting patterns.
+
+Usage:
+
+	knit <command> [flags] [file]
+
+The pattern is read from the given file, or from stdin if the file is
+omitted or `-`. The commands are:
+
+	parse    Print the parse tree of the pattern.
+	expand   Expand references to patterns in a library directory.
+	unroll   Print the pattern with all repeats written out.
+	count    Print the stitch counts of every row and check them.
+	chart    Print the chart of the pattern, as text or SVG.
+	convert  Convert the pattern to another format.
+	track    Walk through the pattern row by row and stitch by stitch.
+	serve    Preview the patterns in a directory in a web browser.
+
+The input format is inferred from the file extension: `.json` for JSON,
+`.xml` or `.knitml` for KnitML, `.chart` for text charts and the pattern
+syntax for anything else. Use -from to override it. The format `prose`
+reads written patterns leniently. A file holding several sections is read
+as a document; -pattern selects the section to use.
+
+With -json, the output is written as JSON, for use in scripts. Errors are
+written to stdout as well, as an object holding an "error" field. Notes on
+how the input was read are written to stderr.
+
+The track command reads the pattern from a file and commands from stdin,
+one per line. Type help for a list. Progress is saved to a state file
+after every command, so a session can be resumed later.
+
+The serve command reads every pattern file in a directory and serves a
+page for each of them on -addr. A page shows the chart, the written
+instructions, the stitch counts and any problems found in the pattern.
+References between the patterns are expanded. The directory is checked
+for changes every -poll interval and open pages reload when it changes.
+
+The exit status is 0 on success, 1 if the pattern could not be read or
+failed a check and 2 if the command was used incorrectly.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jteeuwen/knit"
+)
+
+// Exit codes.
+const (
+	exitOk    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
+
+// errUsage is returned for incorrect use of a command.
+var errUsage = errors.New("usage")
+
+// reportedError wraps an error which is already part of the JSON output.
+type reportedError struct{ error }
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// A command is a single knit subcommand.
+type command struct {
+	name  string
+	args  string // Additional flags, for the usage text.
+	short string
+	run   func(c *context, p *knit.Pattern) error
+	dir   bool // Is the argument a directory, rather than a pattern file?
+}
+
+var commands = []*command{
+	{"parse", "", "Print the parse tree of the pattern.", runParse, false},
+	{"expand", "-lib dir", "Expand references to patterns in a library directory.", runExpand, false},
+	{"unroll", "", "Print the pattern with all repeats written out.", runUnroll, false},
+	{"count", "", "Print the stitch counts of every row and check them.", runCount, false},
+	{"chart", "[-svg]", "Print the chart of the pattern, as text or SVG.", runChart, false},
+	{"convert", "-to format", "Convert the pattern to another format.", runConvert, false},
+	{"track", "[-state file]", "Walk through the pattern row by row and stitch by stitch.", runTrack, false},
+	{"serve", "[-addr host:port]", "Preview the patterns in a directory in a web browser.", runServe, true},
+}
+
+// context holds the settings and streams for a single run.
+type context struct {
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	json    bool          // Write output as JSON.
+	from    string        // Input format.
+	to      string        // Output format for convert.
+	lib     string        // Library directory for references.
+	pattern string        // Section to use from a document.
+	svg     bool          // Draw charts as SVG.
+	file    string        // Input file; empty for stdin.
+	state   string        // State file for track.
+	addr    string        // Address to serve on.
+	poll    time.Duration // Interval at which serve checks for changes.
+}
+
+// run runs the command line given by args and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+
+	var cmd *command
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			cmd = c
+		}
+	}
+
+	if cmd == nil {
+		if args[0] != "help" && args[0] != "-h" && args[0] != "-help" {
+			fmt.Fprintf(stderr, "knit: unknown command %q\n", args[0])
+		}
+
+		usage(stderr)
+		return exitUsage
+	}
+
+	c := &context{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	fs := flag.NewFlagSet("knit "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&c.json, "json", false, "Write output as JSON.")
+	fs.StringVar(&c.from, "from", "", "Input format: knit, prose, json, knitml or chart.")
+	fs.StringVar(&c.lib, "lib", "", "Library `dir` holding .knit files with referenced patterns.")
+	fs.StringVar(&c.pattern, "pattern", "", "Name of the section to use from a document.")
+
+	switch cmd.name {
+	case "chart":
+		fs.BoolVar(&c.svg, "svg", false, "Draw the chart as SVG.")
+	case "convert":
+		fs.StringVar(&c.to, "to", "", "Output format: knit, json, knitml, chart or svg.")
+	case "track":
+		fs.StringVar(&c.state, "state", "", "Progress `file`. Defaults to the pattern file name plus .progress.")
+	case "serve":
+		fs.StringVar(&c.addr, "addr", "localhost:8080", "Address to serve on.")
+		fs.DurationVar(&c.poll, "poll", time.Second, "Interval at which to check the directory for changes.")
+	}
+
+	fs.Usage = func() {
+		arg := "[file]"
+
+		if cmd.dir {
+			arg = "dir"
+		}
+
+		fmt.Fprintf(stderr, "Usage: knit %s [flags] %s %s\n\n%s\n\n", cmd.name, cmd.args, arg, cmd.short)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var p *knit.Pattern
+	var err error
+
+	c.file = fs.Arg(0)
+
+	if !cmd.dir {
+		p, err = c.load(c.file)
+	}
+
+	if err == nil && p != nil && len(c.lib) > 0 {
+		err = c.expand(p)
+	}
+
+	if err == nil {
+		err = cmd.run(c, p)
+	}
+
+	switch {
+	case err == errUsage:
+		fs.Usage()
+		return exitUsage
+	case err != nil:
+		if _, ok := err.(reportedError); c.json && !ok {
+			c.writeJSON(struct {
+				Error string `json:"error"`
+			}{err.Error()})
+		} else {
+			fmt.Fprintf(stderr, "knit: %v\n", err)
+		}
+
+		return exitFail
+	}
+
+	return exitOk
+}
+
+// usage writes the list of commands.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: knit <command> [flags] [file]\n\nCommands:\n")
+
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.short)
+	}
+
+	fmt.Fprintf(w, "\nRun `knit <command> -h` for the flags of a command.\n")
+}
+
+// load reads the pattern from the given file, or stdin.
+func (c *context) load(file string) (*knit.Pattern, error) {
+	var data []byte
+	var err error
+
+	if len(file) == 0 || file == "-" {
+		data, err = ioutil.ReadAll(c.stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.parse(file, data)
+}
+
+// parse parses the contents of the given file, or stdin if the file is
+// empty or `-`.
+func (c *context) parse(file string, data []byte) (*knit.Pattern, error) {
+	name := "stdin"
+
+	if len(file) > 0 && file != "-" {
+		name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+
+	from := c.from
+
+	if len(from) == 0 {
+		from = formatOf(file)
+	}
+
+	src := string(data)
+
+	switch from {
+	case "knit":
+		if !knit.HasSections(src) {
+			return knit.Parse(name, src)
+		}
+
+		doc, err := knit.ParseDocument(name, src)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return c.section(doc)
+
+	case "prose":
+		p, notes, err := knit.ParseLenient(name, src)
+
+		for _, n := range notes {
+			fmt.Fprintf(c.stderr, "%s:%s\n", name, n)
+		}
+
+		return p, err
+
+	case "json":
+		p := new(knit.Pattern)
+		return p, json.Unmarshal(data, p)
+
+	case "knitml":
+		p, issues, err := knit.ReadKnitML(name, bytes.NewReader(data))
+
+		for _, is := range issues {
+			fmt.Fprintf(c.stderr, "%s:%s\n", name, is)
+		}
+
+		return p, err
+
+	case "chart":
+		return knit.ParseChart(name, src, nil)
+	}
+
+	return nil, fmt.Errorf("unknown input format %q", from)
+}
+
+// section returns the pattern selected by -pattern from the document.
+func (c *context) section(doc knit.Document) (*knit.Pattern, error) {
+	if len(c.pattern) > 0 {
+		if p := doc.Pattern(c.pattern); p != nil {
+			return p, nil
+		}
+
+		return nil, fmt.Errorf("document has no pattern %q", c.pattern)
+	}
+
+	if names := doc.Names(); len(names) == 1 {
+		return doc[names[0]], nil
+	}
+
+	return nil, fmt.Errorf("document holds several patterns, select one with -pattern: %s",
+		strings.Join(doc.Names(), ", "))
+}
+
+// expand expands references in p to patterns in the library directory.
+func (c *context) expand(p *knit.Pattern) error {
+	doc, err := knit.ParseDir(c.lib)
+
+	if err != nil {
+		return err
+	}
+
+	return p.Expand(doc.Reference)
+}
+
+// writeJSON writes v as indented JSON.
+func (c *context) writeJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(c.stdout, "%s\n", data)
+	return err
+}
+
+// writePattern writes the pattern in the pattern syntax, or as JSON.
+func (c *context) writePattern(p *knit.Pattern) error {
+	if c.json {
+		return c.writeJSON(p)
+	}
+
+	_, err := fmt.Fprintln(c.stdout, p)
+	return err
+}
+
+// formatOf returns the input format for the given file name.
+func formatOf(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return "json"
+	case ".xml", ".knitml":
+		return "knitml"
+	case ".chart":
+		return "chart"
+	}
+
+	return "knit"
+}
@@ -0,0 +1,243 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib")
+	file := filepath.Join(dir, "Scarf.knit")
+
+	write := func(file, data string) {
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(lib, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	write(filepath.Join(lib, "Rib.knit"), "K2 P2")
+	write(file, "Row 1: Co8 (8 sts)\nRow 2: [Rib] 2 (8 sts)\nRow 3: [K2 P2] 2")
+
+	for _, tc := range []struct {
+		args  []string
+		stdin string
+		exit  int
+		want  string
+	}{
+		{nil, "", exitUsage, ""},
+		{[]string{"knot"}, "", exitUsage, ""},
+		{[]string{"parse"}, "K2 P2", exitOk, "*knit.Stitch(\"K\")"},
+		{[]string{"parse"}, "K2 {", exitFail, ""},
+		{[]string{"parse", "-json"}, "K2", exitOk, `"type": "stitch"`},
+		{[]string{"expand", file}, "", exitUsage, ""},
+		{[]string{"expand", "-lib", lib, file}, "", exitOk, "Row2: [[K2 P2]]2 (8 sts)"},
+		{[]string{"unroll"}, "Row 1: [K P] 2", exitOk, "Row1: K P K P"},
+		{[]string{"unroll", "-from", "prose"}, "Row 1: *k1, p1; rep from * once more", exitOk, "Row1: K P K P"},
+		{[]string{"count", "-lib", lib, file}, "", exitOk, "Row 3: 8 sts"},
+		{[]string{"count"}, "Row 1: Co4 (5 sts)", exitFail, "Row 1: 4 sts"},
+		{[]string{"count", "-json"}, "Row 1: Co4", exitOk, `"after": 4`},
+		{[]string{"count", "-json"}, "Row 1: Co4 (5 sts)", exitFail, `"msg"`},
+		{[]string{"parse", "-json"}, "K2 {", exitFail, `"error": "`},
+		{[]string{"chart"}, "Row 1: K2 P2\nRow 2: K4", exitOk, "2 ----\n  --|| 1"},
+		{[]string{"chart", "-svg"}, "Row 1: K2", exitOk, "<svg"},
+		{[]string{"convert", "-to", "json"}, "K2", exitOk, `"kind": "K"`},
+		{[]string{"convert", "-to", "knitml"}, "Row 1: Co2", exitOk, "<cast-on>2</cast-on>"},
+		{[]string{"convert", "-from", "chart", "-to", "knit"}, "2 --\n  || 1", exitOk, "Row1: K K \nRow2: K K"},
+		{[]string{"convert", "-to", "pdf"}, "K2", exitFail, ""},
+		{[]string{"convert"}, "K2", exitUsage, ""},
+		{[]string{"parse"}, "# Front\nK2\n# Back\nP2", exitFail, ""},
+		{[]string{"parse", "-pattern", "back"}, "# Front\nK2\n# Back\nP2", exitOk, "*knit.Stitch(\"P\")"},
+	} {
+		var stdout, stderr bytes.Buffer
+
+		exit := run(tc.args, strings.NewReader(tc.stdin), &stdout, &stderr)
+
+		if exit != tc.exit {
+			t.Fatalf("%v: want exit %d, have %d\n%s", tc.args, tc.exit, exit, stderr.String())
+		}
+
+		if !strings.Contains(stdout.String(), tc.want) {
+			t.Fatalf("%v: want output containing %q, have:\n%s", tc.args, tc.want, stdout.String())
+		}
+	}
+}
+
+func TestTrack(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "Scarf.knit")
+
+	if err := ioutil.WriteFile(file, []byte("Row 1: Co4\nRow 2: K1 [P1] 2 K1\nRow 3: K4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	session := func(script string) []string {
+		var stdout, stderr bytes.Buffer
+
+		if exit := run([]string{"track", file}, strings.NewReader(script), &stdout, &stderr); exit != exitOk {
+			t.Fatalf("Want exit %d, have %d\n%s", exitOk, exit, stderr.String())
+		}
+
+		return strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	}
+
+	out := session("row\n\n2\nback\ngoto 3\nback\nquit\nrow\n")
+	want := []string{
+		"Row 1 RS, stitch 1 of 4: Co (repeat 1 of 4), 0 sts -> 4 sts",
+		"Row 2 WS, stitch 1 of 4: K, 4 sts -> 4 sts",
+		"Row 2 WS, stitch 2 of 4: P (repeat 1 of 2), 4 sts -> 4 sts",
+		"Row 2 WS, stitch 4 of 4: K, 4 sts -> 4 sts",
+		"Row 2 WS, stitch 2 of 4: P (repeat 1 of 2), 4 sts -> 4 sts",
+		"Row 3 RS, stitch 1 of 4: K (repeat 1 of 4), 4 sts -> 4 sts",
+		"Row 2 WS, stitch 2 of 4: P (repeat 1 of 2), 4 sts -> 4 sts",
+	}
+
+	if strings.Join(out, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Session:\nWant:\n%s\nHave:\n%s", strings.Join(want, "\n"), strings.Join(out, "\n"))
+	}
+
+	// The next session resumes where the previous one stopped.
+	out = session("row\nrow\nnext\n")
+
+	if want := "Row 2 WS, stitch 2 of 4: P (repeat 1 of 2), 4 sts -> 4 sts"; out[0] != want {
+		t.Fatalf("Resume:\nWant: %s\nHave: %s", want, out[0])
+	}
+
+	if want := "The pattern is finished."; out[len(out)-1] != want {
+		t.Fatalf("Finish:\nWant: %s\nHave: %s", want, out[len(out)-1])
+	}
+
+	// A changed pattern starts over.
+	if err := ioutil.WriteFile(file, []byte("Row 1: Co6\nRow 2: [K1 P2] 2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out = session("row\n2\n")
+	want = []string{
+		`Progress "Scarf": The saved position belongs to a different pattern. Starting over.`,
+		"Row 1 RS, stitch 1 of 6: Co (repeat 1 of 6), 0 sts -> 6 sts",
+		"Row 2 WS, stitch 1 of 6: K (repeat 1 of 2), 6 sts -> 6 sts",
+		"Row 2 WS, stitch 3 of 6: P (repeat 1 of 2, 2 of 2), 6 sts -> 6 sts",
+	}
+
+	if strings.Join(out, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Changed:\nWant:\n%s\nHave:\n%s", strings.Join(want, "\n"), strings.Join(out, "\n"))
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	if exit := run([]string{"track"}, strings.NewReader("K2"), &stdout, &stderr); exit != exitUsage {
+		t.Fatalf("Want exit %d for a pattern on stdin, have %d", exitUsage, exit)
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(file, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("Scarf.knit", "Row 1: Co4\nRow 2: Rib\nRow 3: K4")
+	write("Rib.knit", "[K1 P1] 2")
+	write("Counted.knit", "Row 1: Co4 (5 sts)")
+	write("Broken.knit", "Row 1: K2 {")
+	write("Loop.knit", "Row 1: Loop")
+	write("notes.txt", "Not a pattern.")
+
+	var stdout, stderr bytes.Buffer
+
+	s := newServer(&context{stderr: &stderr}, dir)
+
+	if err := s.scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string, status int, want ...string) string {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+		if w.Code != status {
+			t.Fatalf("%s: Want status %d, have %d", path, status, w.Code)
+		}
+
+		for _, str := range want {
+			if !strings.Contains(w.Body.String(), str) {
+				t.Fatalf("%s: Missing %q in:\n%s", path, str, w.Body.String())
+			}
+		}
+
+		return w.Body.String()
+	}
+
+	if page := get("/", http.StatusOK, `href="/pattern/Scarf"`, `href="/pattern/Rib"`); strings.Contains(page, "notes") {
+		t.Fatalf("Unexpected page for notes.txt:\n%s", page)
+	}
+
+	if page := get("/pattern/Scarf", http.StatusOK, "<svg", "Row2: Rib", "<td>2</td><td>4</td><td>4</td>"); strings.Contains(page, "Problems") {
+		t.Fatalf("Unexpected problems:\n%s", page)
+	}
+
+	get("/pattern/counted", http.StatusOK, "Problems", "Row ends with 4 stitches, but 5 are stated.")
+	get("/pattern/Broken", http.StatusOK, "Problems", "Broken:1:")
+	get("/pattern/Loop", http.StatusOK, "Cyclic reference")
+	get("/pattern/Hat", http.StatusNotFound)
+	get("/changes?since=0", http.StatusOK, "1\n")
+
+	// A change to a referenced pattern is picked up by a pending request
+	// for changes.
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	version := make(chan string)
+
+	go func() {
+		resp, err := http.Get(srv.URL + "/changes?since=1")
+
+		if err != nil {
+			version <- err.Error()
+			return
+		}
+
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		version <- string(data)
+	}()
+
+	write("Rib.knit", "[K1 P1] 3")
+
+	if err := s.scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := <-version; v != "2\n" {
+		t.Fatalf("Want version 2, have %q", v)
+	}
+
+	get("/pattern/Scarf", http.StatusOK, "<td>2</td><td>4</td><td>6</td>")
+
+	if err := s.scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	get("/changes?since=0", http.StatusOK, "2\n")
+
+	if exit := run([]string{"serve"}, strings.NewReader(""), &stdout, &stderr); exit != exitUsage {
+		t.Fatalf("Want exit %d without a directory, have %d", exitUsage, exit)
+	}
+}
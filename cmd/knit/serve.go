@@ -0,0 +1,460 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jteeuwen/knit"
+)
+
+// changesTimeout is how long a request for changes waits before
+// answering that nothing changed.
+const changesTimeout = 30 * time.Second
+
+// A page holds everything shown for a single pattern.
+type page struct {
+	Name        string
+	File        string        // Base name of the file defining the pattern.
+	Diagnostics []string      // Problems found while reading and checking the pattern.
+	Chart       template.HTML // SVG chart.
+	Text        string        // Written instructions.
+	Counts      []*pageCount  // Stitch counts of every row.
+	pattern     *knit.Pattern
+}
+
+// pageCount holds the stitch counts of a row, as shown on a page.
+type pageCount struct {
+	Row, Before, After, Held int
+}
+
+// A server serves a preview of every pattern in a directory. The pages
+// are rebuilt whenever a file in the directory changes.
+type server struct {
+	c       *context
+	dir     string
+	mux     *http.ServeMux
+	mu      sync.Mutex
+	files   map[string][]byte // Contents of the pattern files, by name.
+	pages   []*page           // Pages, sorted by name.
+	version int               // Incremented whenever the pages change.
+	changed chan struct{}     // Closed when the pages change.
+}
+
+// runServe serves previews of the patterns in the given directory until
+// the server fails.
+func runServe(c *context, _ *knit.Pattern) error {
+	if len(c.file) == 0 || c.poll <= 0 {
+		return errUsage
+	}
+
+	s := newServer(c, c.file)
+
+	if err := s.scan(); err != nil {
+		return err
+	}
+
+	go s.watch(c.poll)
+
+	fmt.Fprintf(c.stdout, "Serving %s on http://%s/\n", c.file, c.addr)
+	return http.ListenAndServe(c.addr, s)
+}
+
+// newServer creates a server for the given directory. Call scan to read
+// the patterns.
+func newServer(c *context, dir string) *server {
+	s := &server{c: c, dir: dir, mux: http.NewServeMux(), changed: make(chan struct{})}
+	s.mux.HandleFunc("/", s.serveIndex)
+	s.mux.HandleFunc("/pattern/", s.servePattern)
+	s.mux.HandleFunc("/changes", s.serveChanges)
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// watch scans the directory at the given interval. Errors are reported
+// once, until the next scan succeeds.
+func (s *server) watch(interval time.Duration) {
+	var last string
+
+	for range time.Tick(interval) {
+		err := s.scan()
+
+		if err != nil && err.Error() != last {
+			fmt.Fprintf(s.c.stderr, "knit: %v\n", err)
+		}
+
+		last = ""
+
+		if err != nil {
+			last = err.Error()
+		}
+	}
+}
+
+// scan reads the pattern files in the directory and rebuilds the pages
+// if any of them changed. Files with the extension of one of the input
+// formats are read. With -from, all files are read in that format.
+func (s *server) scan() error {
+	list, err := ioutil.ReadDir(s.dir)
+
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string][]byte)
+
+	for _, fi := range list {
+		name := fi.Name()
+
+		if fi.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".knit", ".json", ".xml", ".knitml", ".chart":
+		default:
+			if len(s.c.from) == 0 {
+				continue
+			}
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+
+		if err != nil {
+			return err
+		}
+
+		files[name] = data
+	}
+
+	s.mu.Lock()
+	same := sameFiles(files, s.files)
+	s.mu.Unlock()
+
+	if same {
+		return nil
+	}
+
+	pages := s.build(files)
+
+	s.mu.Lock()
+	s.files, s.pages = files, pages
+	s.version++
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+	return nil
+}
+
+// sameFiles returns true if both sets of files have the same contents.
+func sameFiles(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for name, data := range a {
+		other, ok := b[name]
+
+		if !ok || !bytes.Equal(data, other) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// build creates the pages for the given files. References between the
+// patterns are expanded.
+func (s *server) build(files map[string][]byte) []*page {
+	var all, list []*page
+
+	for name, data := range files {
+		all = append(all, s.read(name, data)...)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		a, b := strings.ToLower(all[i].Name), strings.ToLower(all[j].Name)
+		return a < b || a == b && all[i].File < all[j].File
+	})
+
+	doc := make(knit.Document)
+	index := make(map[string]*page)
+
+	for _, pg := range all {
+		key := strings.ToLower(pg.Name)
+
+		if first, ok := index[key]; ok {
+			first.Diagnostics = append(first.Diagnostics,
+				fmt.Sprintf("%s: Duplicate pattern %q.", pg.File, pg.Name))
+			continue
+		}
+
+		index[key] = pg
+		list = append(list, pg)
+
+		if pg.pattern != nil {
+			doc[pg.Name] = pg.pattern.Copy()
+		}
+	}
+
+	for _, pg := range list {
+		if pg.pattern != nil {
+			pg.check(doc)
+		}
+	}
+
+	return list
+}
+
+// read parses the given file into one page per pattern. A file holding
+// sections yields a page for every section.
+func (s *server) read(file string, data []byte) []*page {
+	var notes bytes.Buffer
+
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+	from := s.c.from
+
+	if len(from) == 0 {
+		from = formatOf(file)
+	}
+
+	if from == "knit" && knit.HasSections(string(data)) {
+		doc, err := knit.ParseDocument(file, string(data))
+
+		if err != nil {
+			return []*page{{Name: name, File: file, Diagnostics: []string{err.Error()}}}
+		}
+
+		var list []*page
+
+		for _, key := range doc.Names() {
+			list = append(list, &page{Name: key, File: file, pattern: doc[key]})
+		}
+
+		return list
+	}
+
+	c := *s.c
+	c.stderr = &notes
+
+	p, err := c.parse(file, data)
+	pg := &page{Name: name, File: file, pattern: p}
+
+	for _, line := range strings.Split(notes.String(), "\n") {
+		if len(line) > 0 {
+			pg.Diagnostics = append(pg.Diagnostics, line)
+		}
+	}
+
+	if err != nil {
+		pg.Diagnostics = append(pg.Diagnostics, err.Error())
+		pg.pattern = nil
+	}
+
+	return []*page{pg}
+}
+
+// check expands the page's pattern with the patterns in the document and
+// fills in its instructions, stitch counts and chart.
+func (pg *page) check(doc knit.Document) {
+	pg.Text = pg.pattern.String()
+
+	if err := doc.Resolve(pg.Name); err != nil {
+		pg.Diagnostics = append(pg.Diagnostics, err.Error())
+	}
+
+	p := doc.Pattern(pg.Name)
+	counts, err := p.StitchCounts()
+
+	if errs, ok := err.(knit.CountErrors); ok {
+		for _, ce := range errs {
+			pg.Diagnostics = append(pg.Diagnostics, ce.Error())
+		}
+	} else if err != nil {
+		pg.Diagnostics = append(pg.Diagnostics, err.Error())
+	}
+
+	// Without stitch counts, the pattern can not be unrolled. The chart
+	// would fail for the same reason.
+	if counts == nil {
+		return
+	}
+
+	for i, rc := range counts {
+		pg.Counts = append(pg.Counts, &pageCount{rowNumber(rc.Row, i), rc.Before, rc.After, rc.Held})
+	}
+
+	chart, err := p.ChartSVG(nil)
+
+	if err != nil {
+		pg.Diagnostics = append(pg.Diagnostics, err.Error())
+		return
+	}
+
+	pg.Chart = template.HTML(chart)
+}
+
+// serveIndex serves the list of patterns.
+func (s *server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	data := struct {
+		Dir     string
+		Pages   []*page
+		Version int
+	}{s.dir, s.pages, s.version}
+	s.mu.Unlock()
+
+	s.render(w, "index", data)
+}
+
+// servePattern serves the page of a single pattern.
+func (s *server) servePattern(w http.ResponseWriter, r *http.Request) {
+	var pg *page
+
+	name := strings.TrimPrefix(r.URL.Path, "/pattern/")
+
+	s.mu.Lock()
+	version := s.version
+
+	for _, p := range s.pages {
+		if strings.EqualFold(p.Name, name) {
+			pg = p
+		}
+	}
+
+	s.mu.Unlock()
+
+	if pg == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.render(w, "pattern", struct {
+		*page
+		Version int
+	}{pg, version})
+}
+
+// serveChanges answers with the current version of the pages. If it
+// equals the version given by `since`, it first waits for a change, so
+// that pages can poll for changes without delay.
+func (s *server) serveChanges(w http.ResponseWriter, r *http.Request) {
+	since, _ := strconv.Atoi(r.FormValue("since"))
+
+	s.mu.Lock()
+	version, changed := s.version, s.changed
+	s.mu.Unlock()
+
+	if version == since {
+		select {
+		case <-changed:
+		case <-time.After(changesTimeout):
+		case <-r.Context().Done():
+			return
+		}
+
+		s.mu.Lock()
+		version = s.version
+		s.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, version)
+}
+
+// render executes the named template.
+func (s *server) render(w http.ResponseWriter, name string, data interface{}) {
+	var buf bytes.Buffer
+
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+var templates = template.Must(template.New("").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f4f4f4; padding: 1em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: right; }
+.diagnostics { color: #b00; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "reload"}}<script>
+var version = {{.}};
+(function poll() {
+	fetch("/changes?since=" + version).then(function(r) {
+		return r.text();
+	}).then(function(v) {
+		if (Number(v) !== version) {
+			location.reload();
+		} else {
+			poll();
+		}
+	}, function() {
+		setTimeout(poll, 2000);
+	});
+})();
+</script>
+</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "head" .Dir}}
+<h1>{{.Dir}}</h1>
+{{if .Pages}}<ul>
+{{range .Pages}}<li><a href="/pattern/{{.Name}}">{{.Name}}</a> ({{.File}}){{with .Diagnostics}} <span class="diagnostics">{{len .}} problems</span>{{end}}</li>
+{{end}}</ul>
+{{else}}<p>No patterns found.</p>
+{{end}}{{template "reload" .Version}}{{end}}
+
+{{define "pattern"}}{{template "head" .Name}}
+<p><a href="/">All patterns</a></p>
+<h1>{{.Name}}</h1>
+<p>{{.File}}</p>
+{{with .Diagnostics}}<h2>Problems</h2>
+<ul class="diagnostics">
+{{range .}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}{{with .Chart}}<h2>Chart</h2>
+{{.}}
+{{end}}{{with .Text}}<h2>Instructions</h2>
+<pre>{{.}}</pre>
+{{end}}{{with .Counts}}<h2>Stitch counts</h2>
+<table>
+<tr><th>Row</th><th>Before</th><th>After</th><th>Held</th></tr>
+{{range .}}<tr><td>{{.Row}}</td><td>{{.Before}}</td><td>{{.After}}</td><td>{{.Held}}</td></tr>
+{{end}}</table>
+{{end}}{{template "reload" .Version}}{{end}}
+`))
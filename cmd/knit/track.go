@@ -0,0 +1,296 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jteeuwen/knit"
+)
+
+// trackHelp lists the commands understood by the row tracker.
+const trackHelp = `Commands:
+  next [N]   Work the next N stitches. An empty line works one stitch
+             and a bare number works that many.
+  row        Finish the current row.
+  back       Undo the last step.
+  goto N     Jump to the start of row N.
+  status     Show the current position.
+  quit       Save progress and stop.`
+
+// trackState is the progress of a knitting session, as stored in the
+// state file.
+type trackState struct {
+	Progress *knit.Progress  `json:"progress"`
+	History  []knit.Position `json:"history,omitempty"` // Previous positions, for undo.
+}
+
+// A tracker walks a knitter through a pattern.
+type tracker struct {
+	trackState
+	c      *context
+	file   string           // State file.
+	rows   []*knit.RowData  // Rows of the unrolled pattern.
+	counts []*knit.RowCount // Stitch counts of every row.
+}
+
+// runTrack runs an interactive tracking session. Commands are read from
+// stdin, one per line, so the pattern must be read from a file. Progress
+// is saved after every command.
+func runTrack(c *context, p *knit.Pattern) error {
+	if len(c.file) == 0 || c.file == "-" {
+		return errUsage
+	}
+
+	pr, err := knit.NewProgress(p)
+
+	if err != nil {
+		return err
+	}
+
+	q := pr.Pattern()
+	counts, _ := q.StitchCounts()
+
+	t := &tracker{c: c, file: c.state, rows: q.Rows(), counts: counts}
+	t.Progress = pr
+
+	if len(t.file) == 0 {
+		t.file = c.file + ".progress"
+	}
+
+	if err := t.load(); err != nil {
+		return err
+	}
+
+	t.status()
+
+	scan := bufio.NewScanner(c.stdin)
+
+	for scan.Scan() {
+		f := strings.Fields(strings.ToLower(scan.Text()))
+		cmd, arg := "next", ""
+
+		if len(f) > 0 {
+			cmd = f[0]
+		}
+
+		if len(f) > 1 {
+			arg = f[1]
+		}
+
+		// A bare number works that many stitches.
+		if _, err := strconv.Atoi(cmd); err == nil && len(f) == 1 {
+			cmd, arg = "next", cmd
+		}
+
+		if cmd == "quit" || cmd == "q" {
+			break
+		}
+
+		t.command(cmd, arg)
+
+		if err := t.save(); err != nil {
+			return err
+		}
+	}
+
+	if err := scan.Err(); err != nil {
+		return err
+	}
+
+	return t.save()
+}
+
+// command runs a single tracker command.
+func (t *tracker) command(cmd, arg string) {
+	n := 1
+
+	if len(arg) > 0 {
+		v, err := strconv.Atoi(arg)
+
+		if err != nil || v < 1 {
+			fmt.Fprintf(t.c.stdout, "Invalid number %q.\n", arg)
+			return
+		}
+
+		n = v
+	}
+
+	switch cmd {
+	case "next", "n":
+		if t.Progress.Done() {
+			fmt.Fprintln(t.c.stdout, "The pattern is finished.")
+			return
+		}
+
+		t.push()
+		t.Progress.Advance(n)
+
+	case "row", "r":
+		if t.Progress.Done() {
+			fmt.Fprintln(t.c.stdout, "The pattern is finished.")
+			return
+		}
+
+		t.push()
+		t.Progress.NextRow()
+
+	case "back", "b", "undo", "u":
+		k := len(t.History)
+
+		if k == 0 {
+			fmt.Fprintln(t.c.stdout, "Nothing to undo.")
+			return
+		}
+
+		t.Progress.Seek(t.History[k-1])
+		t.History = t.History[:k-1]
+
+	case "goto", "g":
+		if len(arg) == 0 {
+			fmt.Fprintln(t.c.stdout, "Which row? E.g.: goto 12")
+			return
+		}
+
+		for i, row := range t.rows {
+			if rowNumber(row, i) == n {
+				t.push()
+				t.Progress.Seek(knit.Position{Row: i})
+				t.status()
+				return
+			}
+		}
+
+		fmt.Fprintf(t.c.stdout, "There is no row %q.\n", arg)
+		return
+
+	case "status", "s":
+
+	case "help", "h", "?":
+		fmt.Fprintln(t.c.stdout, trackHelp)
+		return
+
+	default:
+		fmt.Fprintf(t.c.stdout, "Unknown command %q. Type help for a list of commands.\n", cmd)
+		return
+	}
+
+	t.status()
+}
+
+// status prints the current position.
+func (t *tracker) status() {
+	pr := t.Progress
+
+	if pr.Done() {
+		fmt.Fprintf(t.c.stdout, "Finished: all %d rows are worked.\n", len(t.rows))
+		return
+	}
+
+	pos := pr.Pos()
+	row := pr.Row()
+	label := fmt.Sprintf("Row %d", rowNumber(row, pos.Row))
+
+	switch {
+	case row.Round:
+		label = fmt.Sprintf("Rnd %d", rowNumber(row, pos.Row))
+	case row.Side == knit.WrongSide:
+		label += " WS"
+	default:
+		label += " RS"
+	}
+
+	st := pr.Stitch()
+
+	if st == nil {
+		fmt.Fprintf(t.c.stdout, "%s: no stitches.\n", label)
+		return
+	}
+
+	s := fmt.Sprintf("%s, stitch %d of %d: %s", label, pos.Stitch+1, len(pr.Stitches()), st)
+
+	if reps := pr.Repeats(); len(reps) > 0 {
+		list := make([]string, len(reps))
+
+		for i, r := range reps {
+			list[i] = fmt.Sprintf("%d of %d", r.Count, r.Total)
+		}
+
+		s += fmt.Sprintf(" (repeat %s)", strings.Join(list, ", "))
+	}
+
+	if pos.Row < len(t.counts) {
+		s += fmt.Sprintf(", %d sts -> %d sts", t.counts[pos.Row].Before, t.counts[pos.Row].After)
+	}
+
+	fmt.Fprintln(t.c.stdout, s)
+}
+
+// push records the current position, so it can be restored by undo.
+func (t *tracker) push() {
+	const max = 1000
+
+	t.History = append(t.History, t.Progress.Pos())
+
+	if len(t.History) > max {
+		t.History = t.History[len(t.History)-max:]
+	}
+}
+
+// load restores the progress from the state file, if it exists.
+func (t *tracker) load() error {
+	data, err := ioutil.ReadFile(t.file)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var ts struct {
+		Progress json.RawMessage `json:"progress"`
+		History  []knit.Position `json:"history"`
+	}
+
+	if err := json.Unmarshal(data, &ts); err != nil {
+		return fmt.Errorf("%s: %v", t.file, err)
+	}
+
+	// Positions of a matching pattern are all valid, so the history
+	// can be kept as it is.
+	if err := t.Progress.UnmarshalJSON(ts.Progress); err != nil {
+		fmt.Fprintf(t.c.stdout, "%v Starting over.\n", err)
+		return nil
+	}
+
+	t.History = ts.History
+	return nil
+}
+
+// save writes the progress to the state file.
+func (t *tracker) save() error {
+	data, err := json.MarshalIndent(&t.trackState, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so an interrupted write does not
+	// lose the previous progress.
+	tmp := t.file + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, t.file)
+}
@@ -0,0 +1,105 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A ColorDef declares a single yarn colour in a pattern's palette.
+//
+// It is written as `{name: value}`. For example `{CC1: navy}` or
+// `{MC: #f5f0e1}`. The name is what stitches refer to, the value is
+// free-form and usually names or describes the actual yarn colour.
+type ColorDef struct {
+	Name  string // Colour identifier. E.g.: MC, CC1 or red.
+	Value string // Colour description. E.g.: navy or #1f3a5f.
+	line  int
+	col   int
+}
+
+// Line returns the original pattern source line number for this declaration.
+func (c *ColorDef) Line() int { return c.line }
+
+// Col returns the original pattern source column number for this declaration.
+func (c *ColorDef) Col() int { return c.col }
+
+func (c *ColorDef) String() string {
+	return fmt.Sprintf("{%s: %s}", c.Name, c.Value)
+}
+
+// Color returns the palette entry for the given colour name.
+// Returns nil if it has not been declared.
+func (p *Pattern) Color(name string) *ColorDef {
+	for _, c := range p.Palette {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// isColorName returns true if v is a valid colour identifier.
+// The empty name is valid and denotes the default colour.
+func isColorName(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if !isLetter(v[i]) && !isDigit(v[i]) && v[i] != '_' && v[i] != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ColorUsage holds usage statistics for a single colour.
+type ColorUsage struct {
+	Color    string // Colour name. Empty for stitches without an explicit colour.
+	Stitches int    // Number of stitches worked in this colour.
+	MaxFloat int    // Longest float of this colour, in stitches.
+}
+
+// Colors returns usage statistics for every colour used in the pattern,
+// in order of first appearance.
+//
+// Refer to Pattern.Floats for a definition of floats.
+func (p *Pattern) Colors() ([]*ColorUsage, error) {
+	var list []*ColorUsage
+
+	index := make(map[string]*ColorUsage)
+	q, err := p.Unrolled()
+
+	if err != nil {
+		return nil, fmt.Errorf("Colors %q: %v", p.Name, err)
+	}
+
+	for i, row := range q.Rows() {
+		for _, node := range row.Nodes {
+			tt, ok := node.(*Stitch)
+
+			if !ok {
+				continue
+			}
+
+			cu, ok := index[tt.Color]
+
+			if !ok {
+				cu = &ColorUsage{Color: tt.Color}
+				index[tt.Color] = cu
+				list = append(list, cu)
+			}
+
+			cu.Stitches++
+		}
+
+		for _, f := range rowFloats(i+1, row.Nodes) {
+			if cu := index[f.Color]; f.Length > cu.MaxFloat {
+				cu.MaxFloat = f.Length
+			}
+		}
+	}
+
+	return list, nil
+}
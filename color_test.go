@@ -0,0 +1,39 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "testing"
+
+func TestColors(t *testing.T) {
+	src := "{MC: cream} {CC1: navy}\nRow 1: {MC} K3 {CC1} K {MC} K2 {CC1} K\nRow 2: {MC} P7"
+
+	p, err := Parse("Fairisle", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "{MC: cream} {CC1: navy}\nRow1: {MC} K3 {CC1} K {MC} K2 {CC1} K \nRow2: {MC} P7"
+
+	if have := p.String(); have != want {
+		t.Fatalf("String: Want %q, have %q", want, have)
+	}
+
+	list, err := p.Colors()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("Colors: Want 2 colours, have %d", len(list))
+	}
+
+	// The CC1 float spans the two MC stitches between its stitches in row 1.
+	if list[0].Stitches != 12 || list[1].Stitches != 2 || list[1].MaxFloat != 2 {
+		t.Fatalf("Colors: unexpected usage: %+v, %+v", list[0], list[1])
+	}
+
+	if _, err := Parse("Undeclared", "{MC: cream} {CC2} K"); err == nil {
+		t.Fatal("Expected error for undeclared colour")
+	}
+}
@@ -0,0 +1,196 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A CountError describes a stitch count inconsistency in a pattern.
+type CountError struct {
+	Line int    // Source line of the offending node.
+	Col  int    // Source column of the offending node.
+	Row  int    // One-based index of the row in the unrolled pattern.
+	Msg  string // Description of the problem.
+}
+
+func (e *CountError) Error() string {
+	return fmt.Sprintf("%d:%d Row %d: %s", e.Line, e.Col, e.Row, e.Msg)
+}
+
+// CountErrors is a list of stitch count inconsistencies.
+type CountErrors []*CountError
+
+func (e CountErrors) Error() string {
+	list := make([]string, len(e))
+
+	for i, ce := range e {
+		list[i] = ce.Error()
+	}
+
+	return strings.Join(list, "\n")
+}
+
+// RowCount holds the live stitch counts for a single row.
+type RowCount struct {
+	Row    *RowData // The row these counts apply to.
+	Before int      // Live stitches before the row is worked.
+	After  int      // Live stitches after the row is worked.
+	Worked int      // Stitches worked off the left needle.
+	Held   int      // Stitches left unworked by short rows, after this row.
+}
+
+// StitchCounts works through the unrolled pattern and returns the live
+// stitch counts for every row.
+//
+// A row must work every stitch available to it, unless it is a short row.
+// A short row ends at a turn: a Turn node or a W&t stitch. The stitches it
+// leaves unworked are held beyond the turn point, while the next row works
+// back over the stitches the short row produced. A later row heading in
+// the same direction picks the held stitches up again, once it has worked
+// past the turn point. Rounds are always worked in the same direction.
+//
+// If the first row does not cast on, it is assumed the needle holds exactly
+// the number of stitches it works.
+//
+// Rows which state their stitch count, as in `(48 sts)`, are checked
+// against the computed count. A mismatch is reported at the position of
+// the stated count.
+//
+// Inconsistencies are returned as a CountErrors value. The counts are
+// returned regardless.
+func (p *Pattern) StitchCounts() ([]*RowCount, error) {
+	var list []*RowCount
+	var errs CountErrors
+	var avail int
+	var held [2]int
+
+	q, err := p.Unrolled()
+
+	if err != nil {
+		return nil, fmt.Errorf("StitchCounts %q: %v", p.Name, err)
+	}
+
+	rows := q.Rows()
+
+	if len(rows) > 0 && !castsOn(rows[0].Nodes) {
+		avail, _ = sequenceCounts(rows[0].Nodes)
+	}
+
+	for i, row := range rows {
+		var consumed, produced int
+		var turned, exceeded bool
+
+		// Direction 0 heads towards the end of a right side row,
+		// direction 1 towards the end of a wrong side row.
+		dir := 0
+
+		if row.Side == WrongSide {
+			dir = 1
+		}
+
+		rc := &RowCount{Row: row, Before: avail + held[0] + held[1]}
+		ahead := avail + held[dir]
+		line, col := rowPosition(row)
+
+		fail := func(node Node, f string, argv ...interface{}) {
+			ce := &CountError{line, col, i + 1, fmt.Sprintf(f, argv...)}
+
+			if node != nil {
+				ce.Line, ce.Col = node.Line(), node.Col()
+			}
+
+			errs = append(errs, ce)
+		}
+
+		for _, node := range row.Nodes {
+			st, ok := node.(*Stitch)
+
+			if !ok {
+				if isTurn(node) {
+					turned = true
+				}
+				continue
+			}
+
+			if turned {
+				fail(st, "Stitch %s follows a turn.", st.Name())
+				turned = false
+			}
+
+			consumed += st.Consumes()
+			produced += st.Produces()
+
+			if consumed > ahead && !exceeded {
+				fail(st, "Row works %d stitches, but only %d are available.",
+					consumed, ahead)
+				exceeded = true
+			}
+
+			if st.Kind == WrapTurn {
+				turned = true
+			}
+		}
+
+		if consumed > ahead {
+			consumed = ahead
+		}
+
+		if !turned && consumed < ahead {
+			fail(nil, "Row leaves %d stitches unworked.", ahead-consumed)
+		}
+
+		held[dir] = ahead - consumed
+		avail = produced
+
+		rc.Worked = consumed
+		rc.Held = held[0] + held[1]
+		rc.After = avail + rc.Held
+		list = append(list, rc)
+
+		if r := row.Row; r != nil && r.Count > 0 && r.Count != rc.After {
+			line, col := r.CountPos()
+			errs = append(errs, &CountError{line, col, i + 1,
+				fmt.Sprintf("Row ends with %d stitches, but %d are stated.", rc.After, r.Count)})
+		}
+	}
+
+	if len(errs) > 0 {
+		return list, errs
+	}
+
+	return list, nil
+}
+
+// Validate checks the stitch counts of the pattern. It returns nil if
+// they are consistent. Refer to Pattern.StitchCounts for details.
+func (p *Pattern) Validate() error {
+	_, err := p.StitchCounts()
+	return err
+}
+
+// castsOn returns true if the given nodes hold a cast-on stitch.
+func castsOn(nodes []Node) bool {
+	for _, node := range nodes {
+		if st, ok := node.(*Stitch); ok && st.Kind == CastOn {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rowPosition returns the source position of the given row.
+func rowPosition(row *RowData) (int, int) {
+	if row.Row != nil {
+		return row.Row.Line(), row.Row.Col()
+	}
+
+	if len(row.Nodes) > 0 {
+		return row.Nodes[0].Line(), row.Nodes[0].Col()
+	}
+
+	return 0, 0
+}
@@ -0,0 +1,119 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestShortRows(t *testing.T) {
+	p, err := Parse("Short", `Row 1: Co10
+		Row 2: P10
+		Row 3: K6 W&t
+		Row 4: P6
+		Row 5: K4 Turn
+		Row 6: Ds P3
+		Row 7: K10`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := p.StitchCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	held := []int{0, 0, 4, 4, 6, 6, 0}
+
+	for i, rc := range counts {
+		if rc.After != 10 || rc.Held != held[i] {
+			t.Fatalf("Row %d: Want 10 sts with %d held, have %d with %d held",
+				i+1, held[i], rc.After, rc.Held)
+		}
+	}
+
+	if !counts[2].Row.Short || counts[3].Row.Short {
+		t.Fatal("Expected only rows 3 and 5 to be short rows")
+	}
+
+	err = MustParse("Invalid", "Row 1: Co10\nRow 2: P8").Validate()
+
+	if list, ok := err.(CountErrors); !ok || len(list) != 1 || list[0].Line != 2 {
+		t.Fatalf("Validate: Expected unworked stitches on line 2, have %v", err)
+	}
+
+	// A pass over lifts a stitch off the right needle.
+	if PassOver.Consumes() != 0 || PassOver.Produces() != -1 {
+		t.Fatalf("PassOver: Want 0/-1, have %d/%d", PassOver.Consumes(), PassOver.Produces())
+	}
+
+	counts, err = MustParse("Pass over", "Row 1: Co5\nRow 2: K Ks K2Tog Psso K").StitchCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rc := counts[1]; rc.Worked != 5 || rc.After != 3 {
+		t.Fatalf("Row 2: Want 5 sts worked into 3, have %d into %d", rc.Worked, rc.After)
+	}
+
+	// At the start of a row, Turn is a reference.
+	p = MustParse("Reference", "Row 1: Turn 2")
+
+	if _, ok := p.Node(1).(*Reference); !ok {
+		t.Fatalf("Want a reference, have %T", p.Node(1))
+	}
+}
+
+func TestStatedCounts(t *testing.T) {
+	p := MustParse("Counts", `Row 1: Co48 (48 sts)
+Row 2: K2Tog K to end (47 sts)
+Rows 3-4: K2Tog K to end (46 sts)`)
+
+	want := "Row1: Co48 (48 sts) \nRow2: K2Tog K to end (47 sts) \nRows3-4: K2Tog K to end (46 sts)"
+
+	if have := p.String(); have != want {
+		t.Fatalf("String:\nWant: %q\nHave: %q", want, have)
+	}
+
+	checkCountError := func(p *Pattern) {
+		err := p.Validate()
+		errs, ok := err.(CountErrors)
+
+		if !ok || len(errs) != 1 {
+			t.Fatalf("Want 1 count error, have %v", err)
+		}
+
+		if ce := errs[0]; ce.Line != 3 || ce.Col != 26 || ce.Row != 4 {
+			t.Fatalf("Unexpected count error: %v", ce)
+		}
+	}
+
+	checkCountError(p)
+
+	// The stated count keeps its source position.
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var q Pattern
+
+	if err := json.Unmarshal(data, &q); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := q.String(); have != want {
+		t.Fatalf("JSON:\nWant: %q\nHave: %q", want, have)
+	}
+
+	checkCountError(&q)
+
+	for _, src := range []string{"K2 (2 sts)", "Row 1: Co2 (2 sts) (2 sts)", "Row 1: Co2 (0 sts)"} {
+		if _, err := Parse("Invalid", src); err == nil {
+			t.Fatalf("Expected error for %q", src)
+		}
+	}
+}
@@ -19,5 +19,21 @@ Usage example:
 or:
 
 	pat := knit.MustParse("MyPattern", "[P3 K3] 10")
+
+A pattern is a sequence of stitch abbreviations, like `K` or `Ssk`, each
+optionally followed by a repeat count. Stitches can be grouped with `[`
+and `]`. Any word which is not a known stitch is a reference to another
+pattern. A stitch can be prefixed with modifiers:
+
+	@  Work through the back loop.
+	^  Knit deep, into the previous row.
+	>  Bring the yarn forward.
+	<  Take the yarn back.
+	&  Work into the same stitch as the previous one. E.g.: `K &@K`
+	   knits into the front and back of a single stitch.
+
+Methods which analyse a pattern, such as Pattern.YarnUsage, work on an
+unrolled copy of it, as returned by Pattern.Unrolled. References must
+have been expanded beforehand. The pattern itself is not modified.
 */
 package knit
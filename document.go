@@ -0,0 +1,340 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Document holds the patterns defined in a single document, keyed by
+// their section name.
+//
+// A document consists of named sections. Each section starts with a line
+// holding its name, preceded by `#`, and holds a single pattern. E.g.:
+//
+//	# Back
+//	Row 1: Co40
+//	Rows 2-60: Rib
+//
+//	# Rib
+//	[K2 P2] 10
+//
+// Section names must consist of letters only and may not collide with
+// stitch names or the `Row`, `Rnd` and `Round` keywords, so that other
+// sections can reference them. A line starting with `#` which is not
+// followed by such a name does not start a section. A metadata header
+// before the first section applies to every section without a header
+// of its own.
+type Document map[string]*Pattern
+
+// Names returns the names of all patterns in the document, in
+// alphabetical order.
+func (d Document) Names() []string {
+	list := make([]string, 0, len(d))
+
+	for name := range d {
+		list = append(list, name)
+	}
+
+	sort.Strings(list)
+	return list
+}
+
+// Pattern returns the pattern with the given name. The lookup is case
+// insensitive. Returns nil if there is no such pattern.
+func (d Document) Pattern(name string) *Pattern {
+	if p, ok := d[name]; ok {
+		return p
+	}
+
+	for key, p := range d {
+		if strings.EqualFold(key, name) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// ParseFile parses the document in the given file, using the builtin
+// stitches. Refer to Parser.ParseDocument for details.
+func ParseFile(file string) (Document, error) {
+	return new(Parser).ParseFile(file)
+}
+
+// ParseDocument parses the given document, using the builtin stitches.
+// Refer to Parser.ParseDocument for details.
+func ParseDocument(name, doc string) (Document, error) {
+	return new(Parser).ParseDocument(name, doc)
+}
+
+// ParseFile parses the document in the given file.
+// Refer to Parser.ParseDocument for details.
+func (ps *Parser) ParseFile(file string) (Document, error) {
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.ParseDocument(file, string(data))
+}
+
+// ParseDir parses all pattern files in the given directory, using the
+// builtin stitches. Refer to Parser.ParseDir for details.
+func ParseDir(dir string) (Document, error) {
+	return new(Parser).ParseDir(dir)
+}
+
+// ParseDir parses all files with the `.knit` extension in the given
+// directory into a single document, which can serve as a library of
+// patterns. A file holding sections contributes all of its sections,
+// as described for Parser.ParseDocument. Any other file holds a single
+// pattern, named after the file without its extension.
+//
+// Pattern names must be unique across all files. References between
+// patterns in the library are expanded.
+func (ps *Parser) ParseDir(dir string) (Document, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.knit"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+	d := make(Document)
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var sub Document
+
+		if HasSections(string(data)) {
+			sub, err = ps.ParseDocument(file, string(data))
+		} else {
+			name := strings.TrimSuffix(filepath.Base(file), ".knit")
+			p, perr := ps.Parse(name, string(data))
+			sub, err = Document{name: p}, perr
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for name, p := range sub {
+			if d.Pattern(name) != nil {
+				return nil, fmt.Errorf("%s: Duplicate pattern %q.", file, name)
+			}
+
+			d[name] = p
+		}
+	}
+
+	for _, key := range d.Names() {
+		if err := d.resolve(key, nil); err != nil {
+			return nil, fmt.Errorf("%s: %v", dir, err)
+		}
+	}
+
+	return d, nil
+}
+
+// Reference returns a copy of the named pattern. It can be passed to
+// Pattern.Expand, to expand references to patterns in the document.
+func (d Document) Reference(name string) (*Pattern, error) {
+	p := d.Pattern(name)
+
+	if p == nil {
+		return nil, fmt.Errorf("Unknown pattern %q.", name)
+	}
+
+	return p.Copy(), nil
+}
+
+// Resolve expands references in the named pattern to other patterns in
+// the document, as done by Parser.ParseDocument. This is useful for
+// documents assembled by hand. References to patterns outside of the
+// document are left in place. A cyclic reference is an error.
+func (d Document) Resolve(name string) error {
+	if d.Pattern(name) == nil {
+		return fmt.Errorf("Unknown pattern %q.", name)
+	}
+
+	return d.resolve(name, nil)
+}
+
+// HasSections returns true if the given document holds a section, as
+// described for Parser.ParseDocument. Lines in a metadata header are not
+// taken to be sections. A source without sections is a single pattern,
+// to be read with Parse rather than ParseDocument.
+func HasSections(doc string) bool {
+	if _, rest, err := parseHeader("", doc); err == nil {
+		doc = rest
+	}
+
+	for _, line := range strings.Split(doc, "\n") {
+		if _, ok := sectionName(line); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseDocument parses the given document and returns all of its patterns.
+//
+// References between patterns in the document are expanded. References
+// to patterns outside of it are left in place. A pattern which ends up
+// referencing itself is an error. Source positions are relative to the
+// start of the document.
+func (ps *Parser) ParseDocument(name, doc string) (Document, error) {
+	var secName string
+	var secLine int
+
+	meta, doc, err := parseHeader(name, doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reg := ps.Stitches
+
+	if reg == nil {
+		reg = builtin
+	}
+
+	d := make(Document)
+	seen := make(map[string]bool)
+	lines := strings.Split(doc, "\n")
+
+	// section parses the lines before line end as the current section.
+	section := func(end int) error {
+		src := strings.Repeat("\n", secLine) + strings.Join(lines[secLine:end], "\n")
+
+		if len(secName) == 0 {
+			if len(strings.TrimSpace(src)) > 0 {
+				return fmt.Errorf("%s:%d:1 Expected section before pattern data,",
+					name, secLine+1)
+			}
+
+			return nil
+		}
+
+		p, err := ps.Parse(secName, src)
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+
+		if p.Meta == nil && meta != nil {
+			p.Meta = meta.copy()
+		}
+
+		d[secName] = p
+		return nil
+	}
+
+	// The header has been blanked out, so it can not start a section.
+	for i, line := range lines {
+		v, ok := sectionName(line)
+
+		if !ok {
+			continue
+		}
+
+		if err := section(i); err != nil {
+			return nil, err
+		}
+
+		secName = v
+		secLine = i + 1
+
+		if isReserved(secName) || reg.Lookup(secName) != nil {
+			return nil, fmt.Errorf("%s:%d:1 Invalid section name %q,", name, i+1, secName)
+		}
+
+		if seen[strings.ToLower(secName)] {
+			return nil, fmt.Errorf("%s:%d:1 Duplicate section %q,", name, i+1, secName)
+		}
+
+		seen[strings.ToLower(secName)] = true
+	}
+
+	if err := section(len(lines)); err != nil {
+		return nil, err
+	}
+
+	for _, key := range d.Names() {
+		if err := d.resolve(key, nil); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return d, nil
+}
+
+// sectionName returns the name of the section started by the given line.
+// The line starts a section if it holds `#`, followed by a name of letters
+// only. E.g.: `# Back`.
+func sectionName(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+
+	if !strings.HasPrefix(line, "#") {
+		return "", false
+	}
+
+	name := strings.TrimSpace(line[1:])
+	return name, len(name) > 0 && isWord(name)
+}
+
+// resolve expands all references in the given pattern to other patterns
+// in the document. The stack holds the patterns currently being resolved,
+// to detect cycles.
+func (d Document) resolve(name string, stack []string) error {
+	for _, s := range stack {
+		if strings.EqualFold(s, name) {
+			return fmt.Errorf("Cyclic reference %s -> %s.", strings.Join(stack, " -> "), name)
+		}
+	}
+
+	return recursive_resolve(d.Pattern(name).Group, d, append(stack, name))
+}
+
+// recursive_resolve recursively replaces references to patterns in the
+// document with copies of those patterns.
+func recursive_resolve(list *Group, d Document, stack []string) error {
+	for i, node := range list.Nodes() {
+		switch tt := node.(type) {
+		case *Group:
+			if err := recursive_resolve(tt, d, stack); err != nil {
+				return err
+			}
+
+		case *Reference:
+			ref := d.Pattern(tt.Name)
+
+			if ref == nil {
+				break
+			}
+
+			if err := d.resolve(tt.Name, stack); err != nil {
+				return fmt.Errorf("%d:%d %v", tt.line, tt.col, err)
+			}
+
+			g := recursive_copy(ref.Group, list)
+			g.line, g.col = tt.line, tt.col
+			list.SetNode(i, g)
+		}
+	}
+
+	return nil
+}
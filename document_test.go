@@ -0,0 +1,149 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDocument(t *testing.T) {
+	d, err := ParseDocument("garment", `---
+Gauge: 20 sts x 28 rows = 10cm
+---
+# Back
+Row 1: Co8
+Rows 2-4: Rib 2
+
+# Sleeve
+Row 1: Co4
+Row 2: Rib Edge
+
+# Rib
+K2 P2`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := strings.Join(d.Names(), " "); have != "Back Rib Sleeve" {
+		t.Fatalf("Unexpected patterns %q", have)
+	}
+
+	back := d.Pattern("back")
+
+	if back.Meta == nil || back.Meta.Gauge == nil || back.Meta.Gauge.Stitches != 20 {
+		t.Fatalf("Expected document gauge, have %+v", back.Meta)
+	}
+
+	if err = back.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// References to patterns outside the document are kept.
+	if _, ok := d["Sleeve"].Node(d["Sleeve"].Len() - 1).(*Reference); !ok {
+		t.Fatal("Expected reference to Edge to remain")
+	}
+
+	if row := d["Sleeve"].Node(3); row.Line() != 10 {
+		t.Fatalf("Expected source line 10, have %d", row.Line())
+	}
+
+	// Context keywords are valid section names.
+	words, err := ParseDocument("words", "# End\nK2\n# Body\nRow 1: Co2\nRow 2: End")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := words["Body"].String(); have != "Row1: Co2 \nRow2: [K2]" {
+		t.Fatalf("Expected End to be expanded, have %q", have)
+	}
+
+	for _, doc := range []string{
+		"K2\n# A\nK",
+		"# A\nK\n# a\nP",
+		"# K2tog\nK",
+		"# Row\nK",
+		"# Kfb\nK",
+		"# A\nB\n# B\nA",
+		"# A\n#\nK",
+	} {
+		if _, err = ParseDocument("invalid", doc); err == nil {
+			t.Fatalf("ParseDocument %q: Expected an error", doc)
+		}
+	}
+
+	// A document assembled by hand.
+	d = Document{
+		"Rib":   MustParse("Rib", "K2 P2"),
+		"Front": MustParse("Front", "Row 1: Co4\nRow 2: Rib Seed"),
+		"Loop":  MustParse("Loop", "Row 1: Loop"),
+	}
+
+	if err = d.Resolve("Front"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := "Row1: Co4 \nRow2: [K2 P2] Seed", d.Pattern("Front").String(); want != have {
+		t.Fatalf("Resolve:\nWant: %q\nHave: %q", want, have)
+	}
+
+	for _, name := range []string{"Loop", "Back"} {
+		if err = d.Resolve(name); err == nil {
+			t.Fatalf("Resolve %q: Expected an error", name)
+		}
+	}
+}
+
+func TestParseDir(t *testing.T) {
+	dir := t.TempDir()
+
+	for file, data := range map[string]string{
+		"Rib.knit":     "K2 P2",
+		"garment.knit": "# Back\nRow 1: Co8\nRow 2: Rib 2",
+		"notes.txt":    "Not a pattern",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := ParseDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := strings.Join(d.Names(), " "); have != "Back Rib" {
+		t.Fatalf("Unexpected library patterns %q", have)
+	}
+
+	p := MustParse("Front", "Row 1: Co4\nRow 2: Rib")
+
+	if err = p.Expand(d.Reference); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = d.Reference("Sleeve"); err == nil {
+		t.Fatal("Reference: Expected an error for an unknown pattern")
+	}
+
+	for doc, want := range map[string]bool{
+		"Row 1: Co4\n  # Rib\nK2 P2":         true,
+		"Row 1: Co4":                         false,
+		"#\nK2 P2":                           false,
+		"# 2x2\nK2 P2":                       false,
+		"---\nTitle: Rib\n---\nK2 P2":        false,
+		"---\nTitle: Rib\n---\n# Rib\nK2 P2": true,
+	} {
+		if have := HasSections(doc); have != want {
+			t.Fatalf("HasSections %q: Want %v, have %v", doc, want, have)
+		}
+	}
+}
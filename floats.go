@@ -0,0 +1,94 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Float is a strand of unused yarn, carried along the wrong side of
+// the work between two consecutive stitches of the same colour.
+type Float struct {
+	Color  string // Colour of the floating strand.
+	Row    int    // One-based index of the row in the unrolled pattern.
+	Column int    // One-based stitch column where the float begins.
+	Length int    // Number of stitches the float spans.
+	Line   int    // Source line of the stitch the float begins after.
+	Col    int    // Source column of the stitch the float begins after.
+}
+
+func (f *Float) String() string {
+	color := f.Color
+
+	if len(color) == 0 {
+		color = "default colour"
+	}
+
+	return fmt.Sprintf("%d:%d row %d, stitch %d: %s floats across %d stitches",
+		f.Line, f.Col, f.Row, f.Column, color, f.Length)
+}
+
+// Floats walks every row of the pattern and returns all floats which
+// span more than max stitches. The pattern syntax has no way to catch
+// floats, so all of them are considered unlocked.
+//
+// Rows and columns are counted in working order, after unrolling.
+func (p *Pattern) Floats(max int) ([]*Float, error) {
+	var list []*Float
+
+	q, err := p.Unrolled()
+
+	if err != nil {
+		return nil, fmt.Errorf("Floats %q: %v", p.Name, err)
+	}
+
+	for i, row := range q.Rows() {
+		for _, f := range rowFloats(i+1, row.Nodes) {
+			if f.Length > max {
+				list = append(list, f)
+			}
+		}
+	}
+
+	return list, nil
+}
+
+// rowFloats returns all floats in the given row of an unrolled pattern.
+// Columns count the stitches of the previous row, so each stitch
+// advances the column by the number of stitches it consumes.
+func rowFloats(row int, nodes []Node) []*Float {
+	var list []*Float
+	var n int
+
+	last := make(map[string]*Stitch)
+	column := make(map[string]int)
+
+	for _, node := range nodes {
+		st, ok := node.(*Stitch)
+
+		if !ok {
+			continue
+		}
+
+		key := strings.ToLower(st.Color)
+
+		if prev, ok := last[key]; ok && n > column[key] {
+			list = append(list, &Float{
+				Color:  prev.Color,
+				Row:    row,
+				Column: column[key] + 1,
+				Length: n - column[key],
+				Line:   prev.Line(),
+				Col:    prev.Col(),
+			})
+		}
+
+		n += st.Kind.Consumes()
+		last[key] = st
+		column[key] = n
+	}
+
+	return list
+}
@@ -0,0 +1,42 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "testing"
+
+func TestFloats(t *testing.T) {
+	p, err := Parse("Floats", "Row 1: [{MC} K {CC1} K6] 2 {MC} K\nRow 2: {MC} P2 {CC1} P3 {MC} P3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := p.Floats(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("Floats: Want 2, have %d: %v", len(list), list)
+	}
+
+	for i, column := range []int{2, 9} {
+		f := list[i]
+
+		if f.Row != 1 || f.Column != column || f.Length != 6 || f.Color != "MC" {
+			t.Fatalf("Floats %d: unexpected float %v", i, f)
+		}
+	}
+
+	// Columns count the stitches of the previous row. A decrease covers
+	// two of them and a yarn over none.
+	p = MustParse("Decreases", "Row 1: {MC} K {CC1} K Dec 2 Yo {MC} K")
+
+	if list, err = p.Floats(4); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].Column != 2 || list[0].Length != 5 {
+		t.Fatalf("Floats: Want 1 float of 5 at column 2, have %v", list)
+	}
+}
@@ -0,0 +1,189 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Unit defines a unit of length.
+type Unit uint8
+
+// Known units of length.
+const (
+	Centimeter Unit = iota
+	Inch
+)
+
+// String returns the abbreviation for the given unit.
+func (u Unit) String() string {
+	switch u {
+	case Centimeter:
+		return "cm"
+	case Inch:
+		return "in"
+	}
+
+	panic("unreachable")
+}
+
+// MarshalText returns the abbreviation for the unit.
+func (u Unit) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText sets the unit from its abbreviation.
+func (u *Unit) UnmarshalText(data []byte) error {
+	if tt, ok := keywords[strings.ToLower(string(data))]; !ok || tt != tokUnit {
+		return fmt.Errorf("Invalid unit %q.", data)
+	}
+
+	*u = getUnit(string(data))
+	return nil
+}
+
+// getUnit returns the unit represented by the given string.
+func getUnit(v string) Unit {
+	if strings.HasPrefix(strings.ToLower(v), "in") {
+		return Inch
+	}
+
+	return Centimeter
+}
+
+// Convert converts the value v, expressed in unit u, to unit to.
+func (u Unit) Convert(v float64, to Unit) float64 {
+	if u == to {
+		return v
+	}
+
+	if u == Inch {
+		return v * 2.54
+	}
+
+	return v / 2.54
+}
+
+// Gauge defines the number of stitches and rows which make up a
+// square swatch of a given size.
+type Gauge struct {
+	Stitches float64 `json:"stitches"`       // Number of stitches across the swatch.
+	Rows     float64 `json:"rows"`           // Number of rows along the swatch.
+	Size     float64 `json:"size,omitempty"` // Width and height of the swatch. Defaults to 10cm or 4in.
+	Unit     Unit    `json:"unit"`           // Unit in which Size is expressed.
+}
+
+// size returns the swatch size, falling back to the customary
+// 10cm or 4in when it was left unset.
+func (g Gauge) size() float64 {
+	if g.Size > 0 {
+		return g.Size
+	}
+
+	if g.Unit == Inch {
+		return 4
+	}
+
+	return 10
+}
+
+// StitchesPer returns the number of stitches in one unit of length u.
+func (g Gauge) StitchesPer(u Unit) float64 {
+	return g.Stitches / g.Unit.Convert(g.size(), u)
+}
+
+// RowsPer returns the number of rows in one unit of length u.
+func (g Gauge) RowsPer(u Unit) float64 {
+	return g.Rows / g.Unit.Convert(g.size(), u)
+}
+
+// Validate returns an error if the gauge can not be used for calculations.
+func (g Gauge) Validate() error {
+	if g.Stitches <= 0 || g.Rows <= 0 || g.Size < 0 {
+		return fmt.Errorf("Invalid gauge %s.", g)
+	}
+
+	return nil
+}
+
+// String returns the gauge in its customary written form.
+// For example: "22 sts x 30 rows = 10cm".
+func (g Gauge) String() string {
+	return fmt.Sprintf("%g sts x %g rows = %g%s",
+		g.Stitches, g.Rows, g.size(), g.Unit)
+}
+
+// ParseGauge parses a gauge in its customary written form, as returned
+// by Gauge.String. E.g.: "22 sts x 30 rows = 10cm". The swatch size is
+// optional and defaults to 10cm.
+func ParseGauge(v string) (Gauge, error) {
+	var g Gauge
+
+	size := ""
+	desc := v
+
+	if i := strings.Index(v, "="); i > -1 {
+		desc, size = v[:i], v[i+1:]
+	}
+
+	f := strings.Fields(strings.ToLower(desc))
+
+	if len(f) != 5 || !strings.HasPrefix(f[1], "st") || f[2] != "x" || !strings.HasPrefix(f[4], "row") {
+		return g, fmt.Errorf("Invalid gauge %q", v)
+	}
+
+	var err error
+
+	if g.Stitches, err = strconv.ParseFloat(f[0], 64); err != nil {
+		return g, fmt.Errorf("Invalid gauge %q", v)
+	}
+
+	if g.Rows, err = strconv.ParseFloat(f[3], 64); err != nil {
+		return g, fmt.Errorf("Invalid gauge %q", v)
+	}
+
+	if len(strings.TrimSpace(size)) > 0 {
+		if g.Size, g.Unit, err = parseLength(size); err != nil {
+			return g, err
+		}
+	}
+
+	if err = g.Validate(); err != nil {
+		return g, err
+	}
+
+	return g, nil
+}
+
+// parseLength parses a length with its unit. E.g.: "10cm" or "4 in".
+func parseLength(v string) (float64, Unit, error) {
+	v = strings.TrimSpace(v)
+	i := strings.LastIndexAny(v, "0123456789.") + 1
+
+	if i == 0 {
+		return 0, 0, fmt.Errorf("Invalid length %q", v)
+	}
+
+	n, err := strconv.ParseFloat(v[:i], 64)
+	unit := strings.ToLower(strings.TrimSpace(v[i:]))
+
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("Invalid length %q", v)
+	}
+
+	var u Unit
+
+	if err = u.UnmarshalText([]byte(unit)); err != nil {
+		return 0, 0, fmt.Errorf("Invalid length unit %q", v)
+	}
+
+	return n, u, nil
+}
+
+// formatLength returns the given length in its written form. E.g.: "10cm".
+func formatLength(v float64, u Unit) string {
+	return strconv.FormatFloat(v, 'f', -1, 64) + u.String()
+}
@@ -0,0 +1,593 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Discriminator values for the "type" field of JSON encoded nodes.
+const (
+	jsonGroup     = "group"
+	jsonStitch    = "stitch"
+	jsonRow       = "row"
+	jsonReference = "reference"
+	jsonNumber    = "number"
+	jsonTurn      = "turn"
+	jsonMarker    = "marker"
+	jsonRepeatTo  = "repeat_to"
+	jsonRowRepeat = "row_repeat"
+)
+
+// jsonNode is the JSON form of any pattern node. Which fields are used
+// depends on the node type. Refer to schema.json for details.
+type jsonNode struct {
+	Type      string      `json:"type"`
+	Line      int         `json:"line"`
+	Col       int         `json:"col"`
+	Kind      string      `json:"kind,omitempty"`
+	Mod       string      `json:"mod,omitempty"`
+	Color     string      `json:"color,omitempty"`
+	Def       *jsonDef    `json:"def,omitempty"`
+	Value     int         `json:"value,omitempty"`
+	From      int         `json:"from,omitempty"`
+	To        int         `json:"to,omitempty"`
+	Count     int         `json:"count,omitempty"`
+	CountLine int         `json:"count_line,omitempty"`
+	CountCol  int         `json:"count_col,omitempty"`
+	Until     float64     `json:"until,omitempty"`
+	Unit      string      `json:"unit,omitempty"`
+	Round     bool        `json:"round,omitempty"`
+	Side      string      `json:"side,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	Op        string      `json:"op,omitempty"`
+	Before    int         `json:"before,omitempty"`
+	End       bool        `json:"end,omitempty"`
+	Nodes     []*jsonNode `json:"nodes,omitempty"`
+}
+
+// jsonDef is the JSON form of a custom stitch definition.
+type jsonDef struct {
+	Name     string `json:"name"`
+	Title    string `json:"title,omitempty"`
+	Consumes int    `json:"consumes"`
+	Produces int    `json:"produces"`
+	Symbol   string `json:"symbol,omitempty"`
+	Expand   string `json:"expand,omitempty"`
+}
+
+// jsonColor is the JSON form of a palette entry.
+type jsonColor struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Line  int    `json:"line"`
+	Col   int    `json:"col"`
+}
+
+// jsonPattern is the JSON form of a pattern.
+type jsonPattern struct {
+	Name     string       `json:"name"`
+	Meta     *Metadata    `json:"meta,omitempty"`
+	Palette  []*jsonColor `json:"palette,omitempty"`
+	Stitches []*jsonDef   `json:"stitches,omitempty"`
+	Nodes    []*jsonNode  `json:"nodes"`
+}
+
+// MarshalJSON encodes the pattern as JSON. Refer to schema.json for
+// a description of the format. It has a value receiver, so that a
+// Pattern value does not pick up the encoder of its embedded Group.
+//
+// All custom stitches used by the pattern are listed before its nodes,
+// including those which only appear in the expansion of another one.
+func (p Pattern) MarshalJSON() ([]byte, error) {
+	jp := &jsonPattern{
+		Name:  p.Name,
+		Meta:  p.Meta,
+		Nodes: []*jsonNode{},
+	}
+
+	for _, c := range p.Palette {
+		jp.Palette = append(jp.Palette, &jsonColor{c.Name, c.Value, c.line, c.col})
+	}
+
+	defs, err := p.customDefs()
+
+	if err != nil {
+		return nil, fmt.Errorf("MarshalJSON %q: %v", p.Name, err)
+	}
+
+	for _, d := range defs {
+		jp.Stitches = append(jp.Stitches, encodeDef(d))
+	}
+
+	if p.Group != nil {
+		jp.Nodes = encodeNode(p.Group).Nodes
+	}
+
+	return json.Marshal(jp)
+}
+
+// UnmarshalJSON decodes a pattern from JSON. Custom stitches are
+// recreated from their definitions, but are not added to any registry
+// other than the pattern's own. The stitch table is registered before
+// any node is read, in the order it is listed.
+func (p *Pattern) UnmarshalJSON(data []byte) error {
+	var jp jsonPattern
+
+	if err := json.Unmarshal(data, &jp); err != nil {
+		return err
+	}
+
+	reg := NewRegistry()
+
+	for _, jd := range jp.Stitches {
+		if jd == nil {
+			return fmt.Errorf("UnmarshalJSON %q: Invalid stitch definition.", jp.Name)
+		}
+
+		if _, err := reg.Register(decodeDef(jd)); err != nil {
+			return fmt.Errorf("UnmarshalJSON %q: %v", jp.Name, err)
+		}
+	}
+
+	root, err := decodeNode(&jsonNode{Type: jsonGroup, Nodes: jp.Nodes}, reg)
+
+	if err != nil {
+		return fmt.Errorf("UnmarshalJSON %q: %v", jp.Name, err)
+	}
+
+	*p = Pattern{Group: root.(*Group), Name: jp.Name, Meta: jp.Meta, reg: reg}
+
+	for _, c := range jp.Palette {
+		p.Palette = append(p.Palette, &ColorDef{c.Name, c.Value, c.Line, c.Col})
+	}
+
+	return nil
+}
+
+// UnmarshalNode decodes a single JSON encoded node of any type.
+func UnmarshalNode(data []byte) (Node, error) {
+	var jn jsonNode
+
+	if err := json.Unmarshal(data, &jn); err != nil {
+		return nil, err
+	}
+
+	return decodeNode(&jn, NewRegistry())
+}
+
+// MarshalJSON encodes the node as JSON.
+func (g *Group) MarshalJSON() ([]byte, error) { return json.Marshal(encodeNode(g)) }
+
+// MarshalJSON encodes the node as JSON.
+func (s *Stitch) MarshalJSON() ([]byte, error) { return json.Marshal(encodeNode(s)) }
+
+// MarshalJSON encodes the node as JSON.
+func (r *Row) MarshalJSON() ([]byte, error) { return json.Marshal(encodeNode(r)) }
+
+// MarshalJSON encodes the node as JSON.
+func (r *Reference) MarshalJSON() ([]byte, error) { return json.Marshal(encodeNode(r)) }
+
+// MarshalJSON encodes the node as JSON.
+func (n *Number) MarshalJSON() ([]byte, error) { return json.Marshal(encodeNode(n)) }
+
+// MarshalJSON encodes the node as JSON.
+func (t *Turn) MarshalJSON() ([]byte, error) { return json.Marshal(encodeNode(t)) }
+
+// MarshalJSON encodes the node as JSON.
+func (m *Marker) MarshalJSON() ([]byte, error) { return json.Marshal(encodeNode(m)) }
+
+// MarshalJSON encodes the node as JSON.
+func (r *RepeatTo) MarshalJSON() ([]byte, error) { return json.Marshal(encodeNode(r)) }
+
+// MarshalJSON encodes the node as JSON.
+func (r *RowRepeat) MarshalJSON() ([]byte, error) { return json.Marshal(encodeNode(r)) }
+
+// UnmarshalJSON decodes the node from JSON.
+func (g *Group) UnmarshalJSON(data []byte) error {
+	node, err := unmarshalAs(data, jsonGroup)
+
+	if err == nil {
+		*g = *node.(*Group)
+
+		// The children still point to the temporary group.
+		for _, n := range g.nodes {
+			if sub, ok := n.(*Group); ok {
+				sub.parent = g
+			}
+		}
+	}
+
+	return err
+}
+
+// UnmarshalJSON decodes the node from JSON.
+func (s *Stitch) UnmarshalJSON(data []byte) error {
+	node, err := unmarshalAs(data, jsonStitch)
+
+	if err == nil {
+		*s = *node.(*Stitch)
+	}
+
+	return err
+}
+
+// UnmarshalJSON decodes the node from JSON.
+func (r *Row) UnmarshalJSON(data []byte) error {
+	node, err := unmarshalAs(data, jsonRow)
+
+	if err == nil {
+		*r = *node.(*Row)
+	}
+
+	return err
+}
+
+// UnmarshalJSON decodes the node from JSON.
+func (r *Reference) UnmarshalJSON(data []byte) error {
+	node, err := unmarshalAs(data, jsonReference)
+
+	if err == nil {
+		*r = *node.(*Reference)
+	}
+
+	return err
+}
+
+// UnmarshalJSON decodes the node from JSON.
+func (n *Number) UnmarshalJSON(data []byte) error {
+	node, err := unmarshalAs(data, jsonNumber)
+
+	if err == nil {
+		*n = *node.(*Number)
+	}
+
+	return err
+}
+
+// UnmarshalJSON decodes the node from JSON.
+func (t *Turn) UnmarshalJSON(data []byte) error {
+	node, err := unmarshalAs(data, jsonTurn)
+
+	if err == nil {
+		*t = *node.(*Turn)
+	}
+
+	return err
+}
+
+// UnmarshalJSON decodes the node from JSON.
+func (m *Marker) UnmarshalJSON(data []byte) error {
+	node, err := unmarshalAs(data, jsonMarker)
+
+	if err == nil {
+		*m = *node.(*Marker)
+	}
+
+	return err
+}
+
+// UnmarshalJSON decodes the node from JSON.
+func (r *RepeatTo) UnmarshalJSON(data []byte) error {
+	node, err := unmarshalAs(data, jsonRepeatTo)
+
+	if err == nil {
+		*r = *node.(*RepeatTo)
+	}
+
+	return err
+}
+
+// UnmarshalJSON decodes the node from JSON.
+func (r *RowRepeat) UnmarshalJSON(data []byte) error {
+	node, err := unmarshalAs(data, jsonRowRepeat)
+
+	if err == nil {
+		*r = *node.(*RowRepeat)
+	}
+
+	return err
+}
+
+// unmarshalAs decodes a node from JSON and ensures it has the given type.
+func unmarshalAs(data []byte, typ string) (Node, error) {
+	var jn jsonNode
+
+	if err := json.Unmarshal(data, &jn); err != nil {
+		return nil, err
+	}
+
+	if jn.Type != typ {
+		return nil, fmt.Errorf("%d:%d Expected node type %q, found %q.",
+			jn.Line, jn.Col, typ, jn.Type)
+	}
+
+	return decodeNode(&jn, NewRegistry())
+}
+
+// encodeNode returns the JSON form of the given node.
+func encodeNode(node Node) *jsonNode {
+	jn := &jsonNode{Line: node.Line(), Col: node.Col()}
+
+	switch tt := node.(type) {
+	case *Group:
+		jn.Type = jsonGroup
+		jn.Nodes = []*jsonNode{}
+
+		for _, n := range tt.Nodes() {
+			jn.Nodes = append(jn.Nodes, encodeNode(n))
+		}
+
+	case *Stitch:
+		jn.Type = jsonStitch
+		jn.Kind = tt.Name()
+		jn.Mod = tt.Mod.String()
+		jn.Color = tt.Color
+
+		if tt.Def != nil {
+			jn.Def = encodeDef(tt.Def)
+		}
+
+	case *Row:
+		jn.Type = jsonRow
+		jn.Value = tt.Value
+		jn.To = tt.To
+		jn.Round = tt.Round
+		jn.Side = tt.Side.String()
+		jn.Count = tt.Count
+		jn.CountLine = tt.countLine
+		jn.CountCol = tt.countCol
+
+	case *Reference:
+		jn.Type = jsonReference
+		jn.Name = tt.Name
+
+	case *Number:
+		jn.Type = jsonNumber
+		jn.Value = tt.Value
+
+	case *Turn:
+		jn.Type = jsonTurn
+
+	case *Marker:
+		jn.Type = jsonMarker
+		jn.Op = tt.Op.String()
+		jn.Name = tt.Name
+
+	case *RepeatTo:
+		jn.Type = jsonRepeatTo
+		jn.Before = tt.Before
+		jn.End = tt.End
+		jn.Name = tt.Name
+
+	case *RowRepeat:
+		jn.Type = jsonRowRepeat
+		jn.From = tt.From
+		jn.To = tt.To
+		jn.Count = tt.Count
+		jn.Round = tt.Round
+
+		if tt.Until > 0 {
+			jn.Until = tt.Until
+			jn.Unit = tt.Unit.String()
+		}
+	}
+
+	return jn
+}
+
+// decodeNode creates a node from its JSON form. Custom stitches are
+// registered with the given registry, the first time they are seen.
+func decodeNode(jn *jsonNode, reg *Registry) (Node, error) {
+	switch jn.Type {
+	case jsonGroup:
+		g := &Group{line: jn.Line, col: jn.Col}
+
+		for _, sub := range jn.Nodes {
+			if sub == nil {
+				return nil, fmt.Errorf("%d:%d Invalid node.", jn.Line, jn.Col)
+			}
+
+			node, err := decodeNode(sub, reg)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if tt, ok := node.(*Group); ok {
+				tt.parent = g
+			}
+
+			g.Append(node)
+		}
+
+		return g, nil
+
+	case jsonStitch:
+		return decodeStitch(jn, reg)
+
+	case jsonRow:
+		side := getSide(jn.Side)
+
+		if side == UnknownSide && len(jn.Side) > 0 {
+			return nil, fmt.Errorf("%d:%d Invalid side %q.", jn.Line, jn.Col, jn.Side)
+		}
+
+		return &Row{Value: jn.Value, To: jn.To, Round: jn.Round, Side: side,
+			Count: jn.Count, line: jn.Line, col: jn.Col,
+			countLine: jn.CountLine, countCol: jn.CountCol}, nil
+
+	case jsonReference:
+		return &Reference{jn.Name, jn.Line, jn.Col}, nil
+
+	case jsonNumber:
+		return &Number{jn.Value, jn.Line, jn.Col}, nil
+
+	case jsonTurn:
+		return &Turn{jn.Line, jn.Col}, nil
+
+	case jsonMarker:
+		op := getMarkerOp(jn.Op)
+
+		if !strings.EqualFold(op.String(), jn.Op) {
+			return nil, fmt.Errorf("%d:%d Invalid marker operation %q.", jn.Line, jn.Col, jn.Op)
+		}
+
+		return &Marker{op, jn.Name, jn.Line, jn.Col}, nil
+
+	case jsonRepeatTo:
+		return &RepeatTo{jn.Before, jn.End, jn.Name, jn.Line, jn.Col}, nil
+
+	case jsonRowRepeat:
+		rr := &RowRepeat{
+			From:  jn.From,
+			To:    jn.To,
+			Count: jn.Count,
+			Until: jn.Until,
+			Round: jn.Round,
+			line:  jn.Line,
+			col:   jn.Col,
+		}
+
+		if len(jn.Unit) > 0 {
+			if err := rr.Unit.UnmarshalText([]byte(jn.Unit)); err != nil {
+				return nil, fmt.Errorf("%d:%d %v", jn.Line, jn.Col, err)
+			}
+		}
+
+		return rr, nil
+	}
+
+	return nil, fmt.Errorf("%d:%d Unknown node type %q.", jn.Line, jn.Col, jn.Type)
+}
+
+// decodeStitch creates a stitch from its JSON form.
+func decodeStitch(jn *jsonNode, reg *Registry) (Node, error) {
+	st := &Stitch{line: jn.Line, col: jn.Col, Color: jn.Color}
+
+	for i := 0; i < len(jn.Mod); i++ {
+		mod := getModKind(jn.Mod[i : i+1])
+
+		if mod == 0 {
+			return nil, fmt.Errorf("%d:%d Invalid stitch modifier %q.", jn.Line, jn.Col, jn.Mod)
+		}
+
+		st.Mod |= mod
+	}
+
+	def := reg.Lookup(jn.Kind)
+
+	if def == nil && jn.Def != nil {
+		var err error
+
+		if def, err = reg.Register(decodeDef(jn.Def)); err != nil {
+			return nil, fmt.Errorf("%d:%d %v", jn.Line, jn.Col, err)
+		}
+	}
+
+	if def == nil {
+		return nil, fmt.Errorf("%d:%d Unknown stitch %q.", jn.Line, jn.Col, jn.Kind)
+	}
+
+	st.Kind = def.Kind
+
+	if def.Custom() {
+		st.Def = def
+	}
+
+	return st, nil
+}
+
+// encodeDef returns the JSON form of the given custom stitch definition.
+func encodeDef(d *StitchDef) *jsonDef {
+	jd := &jsonDef{d.Name, d.Title, d.Consumes, d.Produces, "", d.Expand}
+
+	if d.Symbol != 0 {
+		jd.Symbol = string(d.Symbol)
+	}
+
+	return jd
+}
+
+// decodeDef creates a custom stitch definition from its JSON form.
+func decodeDef(jd *jsonDef) StitchDef {
+	d := StitchDef{
+		Name:     jd.Name,
+		Title:    jd.Title,
+		Consumes: jd.Consumes,
+		Produces: jd.Produces,
+		Expand:   jd.Expand,
+	}
+
+	if len(jd.Symbol) > 0 {
+		d.Symbol = []rune(jd.Symbol)[0]
+	}
+
+	return d
+}
+
+// customDefs returns the definitions of all custom stitches used by the
+// pattern, along with the custom stitches their expansions use. Those are
+// looked up in the registry the pattern was parsed with. A definition is
+// listed after all definitions its expansion uses, so that they can be
+// registered in order.
+func (p *Pattern) customDefs() ([]*StitchDef, error) {
+	var list []*StitchDef
+	var visit func(*Group) error
+
+	reg := p.reg
+
+	if reg == nil {
+		reg = builtin
+	}
+
+	seen := make(map[*StitchDef]bool)
+	cache := make(map[*StitchDef]*Group)
+
+	visit = func(g *Group) error {
+		for _, node := range g.Nodes() {
+			switch tt := node.(type) {
+			case *Group:
+				if err := visit(tt); err != nil {
+					return err
+				}
+
+			case *Stitch:
+				if tt.Def == nil || seen[tt.Def] {
+					break
+				}
+
+				seen[tt.Def] = true
+
+				if len(tt.Def.Expand) > 0 {
+					sub, err := expansion(tt.Def, reg, cache)
+
+					if err != nil {
+						return err
+					}
+
+					if err = visit(sub); err != nil {
+						return err
+					}
+				}
+
+				list = append(list, tt.Def)
+			}
+		}
+
+		return nil
+	}
+
+	if p.Group == nil {
+		return nil, nil
+	}
+
+	if err := visit(p.Group); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
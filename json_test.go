@@ -0,0 +1,132 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	ps := NewParser()
+	ps.Stitches.Register(StitchDef{Name: "MB", Consumes: 1, Produces: 1, Symbol: '*'})
+
+	p, err := ps.Parse("JSON", `---
+Title: Test
+Gauge: 20 sts x 28 rows = 10cm
+---
+{MC: cream} {CC: navy}
+Row 1 RS: Co12
+Rows 2-3: {CC} K2 Pm(A) [@P ^K] 2 MB K to m Sm K to end
+Rep Rows 2-3 until 5cm
+Rnd: K3 Turn ref 2`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var q Pattern
+
+	if err = json.Unmarshal(data, &q); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := p.String(), q.String(); want != have {
+		t.Fatalf("Round trip:\nWant: %s\nHave: %s", want, have)
+	}
+
+	// A value encodes the same as a pointer.
+	value, err := json.Marshal(*p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(value, data) {
+		t.Fatalf("Marshal value:\nWant: %s\nHave: %s", data, value)
+	}
+
+	a, b := p.Node(p.Len()-2), q.Node(q.Len()-2)
+
+	if a.Line() != b.Line() || a.Col() != b.Col() {
+		t.Fatalf("Expected position %d:%d, have %d:%d", a.Line(), a.Col(), b.Line(), b.Col())
+	}
+
+	data, err = json.Marshal(p.Node(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"type":"row","line":6,"col":1,"value":1,"side":"RS"}`; string(data) != want {
+		t.Fatalf("Marshal Row:\nWant: %s\nHave: %s", want, data)
+	}
+
+	if _, err = UnmarshalNode([]byte(`{"type":"cable","line":1,"col":1}`)); err == nil {
+		t.Fatal("Expected unknown node type error")
+	}
+
+	if err = new(Stitch).UnmarshalJSON(data); err == nil {
+		t.Fatal("Expected node type mismatch error")
+	}
+}
+
+func TestJSONStitches(t *testing.T) {
+	ps := NewParser()
+	ps.Stitches.Register(StitchDef{Name: "Tw2", Consumes: 2, Produces: 2, Expand: "@K2"})
+	ps.Stitches.Register(StitchDef{Name: "Cross", Consumes: 4, Produces: 4, Symbol: 'x', Expand: "Tw2 2"})
+
+	p, err := ps.Parse("Nested", "Row 1: Co4\nRow 2: Cross\nRow 3: Cross")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var jp jsonPattern
+
+	if err = json.Unmarshal(data, &jp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tw2 is only used by Cross, so it must be listed before it.
+	if len(jp.Stitches) != 2 || jp.Stitches[0].Name != "Tw2" || jp.Stitches[1].Name != "Cross" {
+		t.Fatalf("Unexpected stitch table %s", data)
+	}
+
+	var q Pattern
+
+	if err = json.Unmarshal(data, &q); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := p.String(), q.String(); want != have {
+		t.Fatalf("Round trip:\nWant: %s\nHave: %s", want, have)
+	}
+
+	if err = p.Lower(ps.Stitches); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = q.Lower(q.reg); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := p.String(), q.String(); want != have {
+		t.Fatalf("Lower:\nWant: %s\nHave: %s", want, have)
+	}
+
+	data = []byte(`{"name":"A","stitches":[{"name":"Cross","consumes":4,"produces":4,"expand":"Tw2 2"}],"nodes":[]}`)
+
+	if err = json.Unmarshal(data, &q); err == nil {
+		t.Fatal("Expected error for a stitch table out of order")
+	}
+}
@@ -0,0 +1,784 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// KnitMLNamespace is the XML namespace of KnitML pattern documents.
+const KnitMLNamespace = "http://www.knitml.com/schema/pattern"
+
+// knitmlStitches maps stitch kinds onto KnitML elements, along with the
+// value of their type attribute, if any. Stitch kinds which are missing
+// can not be represented in KnitML.
+var knitmlStitches = []struct {
+	kind StitchKind
+	elem string
+	typ  string
+}{
+	{KnitStitch, "knit", ""},
+	{PurlStitch, "purl", ""},
+	{KnitSlip, "slip", "knitwise"},
+	{PurlSlip, "slip", "purlwise"},
+	{CastOn, "cast-on", ""},
+	{BindOff, "bind-off", ""},
+	{Increase, "increase", ""},
+	{Decrease, "decrease", ""},
+	{YarnOver, "increase", "yo"},
+	{MakeOneLeft, "increase", "m1l"},
+	{MakeOneRight, "increase", "m1r"},
+	{KnitFrontBack, "increase", "kfb"},
+	{PurlFrontBack, "increase", "pfb"},
+	{LeftLiftedInc, "increase", "lli"},
+	{RightLiftedInc, "increase", "rli"},
+	{K2Tog, "decrease", "k2tog"},
+	{K3Tog, "decrease", "k3tog"},
+	{P2Tog, "decrease", "p2tog"},
+	{P3Tog, "decrease", "p3tog"},
+	{SlipSlipKnit, "decrease", "ssk"},
+	{SlipSlipPurl, "decrease", "ssp"},
+	{S2kp, "decrease", "s2kp"},
+	{Sk2p, "decrease", "sk2p"},
+	{PassOver, "pass-previous-stitch-over", ""},
+	{LeftCross, "cross-stitches", "front"},
+	{RightCross, "cross-stitches", "back"},
+}
+
+// knitmlRepeats maps RepeatTo targets onto KnitML repeat conditions.
+const (
+	knitmlTimes        = "times"
+	knitmlEnd          = "end"
+	knitmlBeforeEnd    = "before-end"
+	knitmlMarker       = "marker"
+	knitmlBeforeMarker = "before-marker"
+)
+
+// A ConvertIssue describes a pattern construct which could not be
+// represented in the target format of a conversion. The construct is
+// dropped or approximated, as described by the message.
+type ConvertIssue struct {
+	Line int    // Source line of the construct.
+	Col  int    // Source column of the construct.
+	Msg  string // Description of the problem.
+}
+
+func (c *ConvertIssue) String() string {
+	return fmt.Sprintf("%d:%d %s", c.Line, c.Col, c.Msg)
+}
+
+// xmlNode is a generic XML element.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []*xmlNode `xml:",any"`
+	line     int
+	col      int
+}
+
+// attr returns the value of the given attribute.
+func (x *xmlNode) attr(name string) string {
+	for _, a := range x.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+// elem creates a new XML element with the given attributes, given as
+// name/value pairs. Attributes with empty values are omitted.
+func elem(name string, attr ...string) *xmlNode {
+	x := &xmlNode{XMLName: xml.Name{Local: name}}
+
+	for i := 0; i+1 < len(attr); i += 2 {
+		if len(attr[i+1]) > 0 {
+			x.Attrs = append(x.Attrs, xml.Attr{Name: xml.Name{Local: attr[i]}, Value: attr[i+1]})
+		}
+	}
+
+	return x
+}
+
+// knitmlWriter holds the state of a KnitML export.
+type knitmlWriter struct {
+	issues []*ConvertIssue
+	color  string // Last colour reported as not exported.
+}
+
+// issue records a construct which can not be represented.
+func (kw *knitmlWriter) issue(node Node, f string, argv ...interface{}) {
+	kw.issues = append(kw.issues, &ConvertIssue{node.Line(), node.Col(), fmt.Sprintf(f, argv...)})
+}
+
+// WriteKnitML writes the pattern to w as a KnitML document.
+//
+// Only a subset of KnitML is produced: a single instruction holding the
+// pattern rows, with repeats, stitch instructions, markers and turns.
+// Each row ends with a stitch count check: the count stated by the row,
+// or the computed count if the stitch counts of the pattern are consistent.
+// Row ranges are written as a list of row numbers.
+// Row repeats and rows nested inside groups are materialised first.
+//
+// Constructs which can not be represented are dropped and returned as
+// a list of issues. These include references, colours, custom stitches,
+// stitch kinds without a KnitML counterpart, the `^` and `&` modifiers and
+// marker names. Metadata other than the title is not written either.
+func (p *Pattern) WriteKnitML(w io.Writer) ([]*ConvertIssue, error) {
+	kw := new(knitmlWriter)
+	q := p.Copy()
+
+	if needsRowUnroll(q.Group) {
+		if q.Meta != nil && q.Meta.Gauge != nil {
+			if err := q.ResolveLengths(*q.Meta.Gauge); err != nil {
+				return nil, fmt.Errorf("WriteKnitML %q: %v", p.Name, err)
+			}
+		}
+
+		if err := q.UnrollRows(); err != nil {
+			return nil, fmt.Errorf("WriteKnitML %q: %v", p.Name, err)
+		}
+	}
+
+	root := elem("pattern", "xmlns", KnitMLNamespace, "version", "0.7")
+	info := elem("general-information")
+	name := elem("name")
+	name.Text = p.Name
+
+	if q.Meta != nil {
+		if len(q.Meta.Title) > 0 {
+			name.Text = q.Meta.Title
+		}
+
+		kw.issues = append(kw.issues, &ConvertIssue{
+			Msg: "Metadata other than the title is not exported.",
+		})
+	}
+
+	if len(q.Palette) > 0 {
+		c := q.Palette[0]
+		kw.issues = append(kw.issues, &ConvertIssue{
+			c.line, c.col, "Colours are not exported.",
+		})
+	}
+
+	info.Children = append(info.Children, name)
+
+	inst := elem("instruction", "id", "main")
+	group := elem("instruction-group", "id", "directions")
+	group.Children = append(group.Children, inst)
+
+	dirs := elem("directions")
+	dirs.Children = append(dirs.Children, group)
+	root.Children = append(root.Children, info, dirs)
+
+	counts, err := q.StitchCounts()
+
+	if err != nil {
+		counts = nil
+	}
+
+	index := 0
+
+	for _, row := range q.Rows() {
+		x := elem("row")
+		n := 1
+
+		if r := row.Row; r != nil {
+			if r.To > r.Value {
+				n = r.To - r.Value + 1
+			}
+
+			var nums []string
+
+			for k := 0; r.Value > 0 && k < n; k++ {
+				nums = append(nums, strconv.Itoa(r.Value+k))
+			}
+
+			x.Attrs = elem("", "number", strings.Join(nums, " ")).Attrs
+
+			if r.Round {
+				x.Attrs = append(x.Attrs, elem("", "type", "round").Attrs...)
+			} else if r.Side != UnknownSide {
+				side := map[Side]string{RightSide: "right", WrongSide: "wrong"}[r.Side]
+				x.Attrs = append(x.Attrs, elem("", "side", side).Attrs...)
+			}
+		}
+
+		x.Children = kw.encode(row.Nodes)
+
+		want := -1
+
+		if row.Row != nil && row.Row.Count > 0 {
+			want = row.Row.Count
+		} else if counts != nil && n == 1 && index < len(counts) {
+			want = counts[index].After
+		}
+
+		if want > -1 {
+			sts := elem("number-of-stitches", "number", strconv.Itoa(want))
+			check := elem("information")
+			check.Children = append(check.Children, sts)
+			x.Children = append(x.Children, check)
+		}
+
+		index += n
+		inst.Children = append(inst.Children, x)
+	}
+
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err = enc.Encode(root); err != nil {
+		return nil, err
+	}
+
+	if _, err = io.WriteString(w, "\n"); err != nil {
+		return nil, err
+	}
+
+	return kw.issues, nil
+}
+
+// encode returns the KnitML elements for the given nodes.
+func (kw *knitmlWriter) encode(nodes []Node) []*xmlNode {
+	var list []*xmlNode
+
+	for i := 0; i < len(nodes); i++ {
+		var x *xmlNode
+
+		switch tt := nodes[i].(type) {
+		case *Group:
+			x = elem("repeat", "until", knitmlTimes, "value", "1")
+			x.Children = kw.encode(tt.Nodes())
+
+		case *Stitch:
+			x = kw.stitch(tt)
+
+		case *Marker:
+			if len(tt.Name) > 0 {
+				kw.issue(tt, "Marker name %q is not exported.", tt.Name)
+			}
+
+			x = elem(map[MarkerOp]string{
+				PlaceMarker:  "place-marker",
+				SlipMarker:   "slip-marker",
+				RemoveMarker: "remove-marker",
+			}[tt.Op])
+
+		case *Turn:
+			x = elem("turn")
+
+		case *Reference:
+			kw.issue(tt, "Reference %q is not exported.", tt.Name)
+
+		case *Row, *RowRepeat:
+			kw.issue(tt, "Nested %T is not exported.", tt)
+
+		default:
+			kw.issue(tt, "Unexpected %T is not exported.", tt)
+		}
+
+		if x == nil {
+			if isRepeat(nodeAt(nodes, i+1)) {
+				i++
+			}
+			continue
+		}
+
+		switch tt := nodeAt(nodes, i+1).(type) {
+		case *Number:
+			i++
+
+			if x.XMLName.Local == "repeat" {
+				x.Attrs[1].Value = strconv.Itoa(tt.Value)
+			} else if len(x.Text) > 0 {
+				x.Text = strconv.Itoa(tt.Value)
+			} else {
+				x = wrapRepeat(x, knitmlTimes, tt.Value)
+			}
+
+		case *RepeatTo:
+			i++
+
+			if len(tt.Name) > 0 {
+				kw.issue(tt, "Marker name %q is not exported.", tt.Name)
+			}
+
+			until := knitmlMarker
+
+			if tt.End {
+				until = knitmlEnd
+			}
+
+			if tt.Before > 0 {
+				until = "before-" + until
+			}
+
+			if x.XMLName.Local == "repeat" {
+				x.Attrs = elem("", "until", until, "value", itoa(tt.Before)).Attrs
+			} else {
+				x = wrapRepeat(x, until, tt.Before)
+			}
+		}
+
+		list = append(list, x)
+	}
+
+	return list
+}
+
+// stitch returns the KnitML element for the given stitch. Elements which
+// take a stitch count hold their count as text. Returns nil if the stitch
+// can not be represented.
+func (kw *knitmlWriter) stitch(st *Stitch) *xmlNode {
+	if st.Def != nil {
+		kw.issue(st, "Custom stitch %s is not exported.", st.Name())
+		return nil
+	}
+
+	for _, ks := range knitmlStitches {
+		if ks.kind != st.Kind {
+			continue
+		}
+
+		var x *xmlNode
+
+		switch ks.elem {
+		case "cross-stitches":
+			x = elem(ks.elem, "first", "1", "next", "1", "type", ks.typ)
+		case "pass-previous-stitch-over":
+			x = elem(ks.elem)
+		default:
+			x = elem(ks.elem, "type", ks.typ)
+			x.Text = "1"
+		}
+
+		if st.Mod&BackLoop != 0 {
+			x.Attrs = append(x.Attrs, elem("", "loop-to-work", "trailing").Attrs...)
+		}
+
+		switch {
+		case st.Mod&YarnForward != 0 && ks.elem == "slip":
+			x.Attrs = append(x.Attrs, elem("", "yarn-position", "front").Attrs...)
+		case st.Mod&YarnBackward != 0 && ks.elem == "slip":
+			x.Attrs = append(x.Attrs, elem("", "yarn-position", "back").Attrs...)
+		case st.Mod&(YarnForward|YarnBackward) != 0:
+			kw.issue(st, "Yarn position of %s is not exported.", st.Name())
+		}
+
+		if st.Mod&(DeepKnit|SameStitch) != 0 {
+			kw.issue(st, "Modifier %q of %s is not exported.",
+				(st.Mod & (DeepKnit | SameStitch)).String(), st.Name())
+		}
+
+		if st.Color != kw.color {
+			kw.issue(st, "Colour change to %q is not exported.", st.Color)
+			kw.color = st.Color
+		}
+
+		return x
+	}
+
+	kw.issue(st, "Stitch %s is not exported.", st.Name())
+	return nil
+}
+
+// wrapRepeat wraps the given element in a repeat element.
+func wrapRepeat(x *xmlNode, until string, value int) *xmlNode {
+	r := elem("repeat", "until", until, "value", itoa(value))
+	r.Children = []*xmlNode{x}
+	return r
+}
+
+// itoa returns the string form of v, or an empty string for 0.
+func itoa(v int) string {
+	if v == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(v)
+}
+
+// needsRowUnroll returns true if the given group holds row repeats, or
+// groups holding rows.
+func needsRowUnroll(g *Group) bool {
+	for _, node := range g.Nodes() {
+		switch tt := node.(type) {
+		case *RowRepeat:
+			return true
+		case *Group:
+			if hasRows(tt) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ReadKnitML reads a pattern from the given KnitML document.
+//
+// Rows, repeats, stitch instructions, markers and turns are converted.
+// Wrapper elements like instruction groups are flattened. A row with a
+// list of row numbers becomes a row range if the numbers are consecutive,
+// or a copy of the row for each number otherwise.
+//
+// The pattern name becomes the title, unless it equals the given name.
+// Stitch count checks become stated stitch counts of their rows and are
+// compared with the computed stitch counts.
+// Mismatches are returned as issues, as are all elements and attributes
+// which can not be represented. Their positions refer to the XML source.
+func ReadKnitML(name string, r io.Reader) (*Pattern, []*ConvertIssue, error) {
+	root, err := readXML(r)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("ReadKnitML %q: %v", name, err)
+	}
+
+	if root.XMLName.Local != "pattern" {
+		return nil, nil, fmt.Errorf("ReadKnitML %q: %d:%d Expected <pattern>, found <%s>.",
+			name, root.line, root.col, root.XMLName.Local)
+	}
+
+	kr := &knitmlReader{p: &Pattern{Name: name, Group: new(Group)}}
+
+	for _, x := range root.Children {
+		switch x.XMLName.Local {
+		case "general-information":
+			for _, c := range x.Children {
+				title := strings.TrimSpace(c.Text)
+
+				if c.XMLName.Local == "name" && title != name {
+					kr.p.Meta = &Metadata{Title: title}
+				}
+			}
+
+		case "directions":
+			kr.directions(x)
+
+		default:
+			kr.issue(x, "Element <%s> is not imported.", x.XMLName.Local)
+		}
+	}
+
+	kr.checkCounts()
+	return kr.p, kr.issues, nil
+}
+
+// knitmlReader holds the state of a KnitML import.
+type knitmlReader struct {
+	p      *Pattern
+	issues []*ConvertIssue
+}
+
+// issue records an element which can not be represented.
+func (kr *knitmlReader) issue(x *xmlNode, f string, argv ...interface{}) {
+	kr.issues = append(kr.issues, &ConvertIssue{x.line, x.col, fmt.Sprintf(f, argv...)})
+}
+
+// directions imports all rows within the given element.
+func (kr *knitmlReader) directions(x *xmlNode) {
+	for _, c := range x.Children {
+		switch c.XMLName.Local {
+		case "instruction-group", "instruction", "section":
+			kr.directions(c)
+		case "row":
+			kr.row(c)
+		default:
+			kr.issue(c, "Element <%s> is not imported.", c.XMLName.Local)
+		}
+	}
+}
+
+// row imports a single row element.
+func (kr *knitmlReader) row(x *xmlNode) {
+	var nums []int
+
+	for _, f := range strings.Fields(x.attr("number")) {
+		n, err := strconv.Atoi(f)
+
+		if err != nil || n < 1 {
+			kr.issue(x, "Invalid row number %q is ignored.", f)
+			continue
+		}
+
+		nums = append(nums, n)
+	}
+
+	row := &Row{line: x.line, col: x.col, Round: x.attr("type") == "round"}
+
+	switch x.attr("side") {
+	case "right":
+		row.Side = RightSide
+	case "wrong":
+		row.Side = WrongSide
+	}
+
+	var body []*xmlNode
+
+	for _, c := range x.Children {
+		if c.XMLName.Local != "information" {
+			body = append(body, c)
+			continue
+		}
+
+		for _, info := range c.Children {
+			n, err := strconv.Atoi(info.attr("number"))
+
+			if info.XMLName.Local == "number-of-stitches" && err == nil {
+				row.Count = n
+				row.countLine, row.countCol = info.line, info.col
+			} else {
+				kr.issue(info, "Element <%s> is not imported.", info.XMLName.Local)
+			}
+		}
+	}
+
+	nodes := kr.decode(body, kr.p.Group)
+	consecutive := len(nums) > 1
+
+	for i := 1; i < len(nums); i++ {
+		consecutive = consecutive && nums[i] == nums[i-1]+1
+	}
+
+	if len(nums) <= 1 || consecutive {
+		if len(nums) > 0 {
+			row.Value = nums[0]
+		}
+
+		if consecutive {
+			row.To = nums[len(nums)-1]
+		}
+
+		kr.p.Append(row)
+		kr.p.Append(nodes...)
+		return
+	}
+
+	for i, n := range nums {
+		r := *row
+		r.Value = n
+
+		if i > 0 {
+			r.Side = UnknownSide
+		}
+
+		kr.p.Append(&r)
+		kr.p.Append(copyNodes(nodes)...)
+	}
+}
+
+// decode returns the pattern nodes for the given KnitML elements.
+// Groups are created as children of parent.
+func (kr *knitmlReader) decode(list []*xmlNode, parent *Group) []Node {
+	var out []Node
+
+	for _, x := range list {
+		name := x.XMLName.Local
+
+		switch name {
+		case "repeat":
+			g := &Group{parent: parent, line: x.line, col: x.col}
+			g.SetNodes(kr.decode(x.Children, g))
+
+			rep := kr.repeat(x)
+
+			// A single repeated stitch needs no group.
+			if st, ok := g.Node(0).(*Stitch); ok && g.Len() == 1 && rep != nil {
+				out = append(out, st, rep)
+			} else if rep != nil {
+				out = append(out, g, rep)
+			} else {
+				out = append(out, g)
+			}
+			continue
+
+		case "place-marker", "slip-marker", "remove-marker":
+			op := map[string]MarkerOp{
+				"place-marker":  PlaceMarker,
+				"slip-marker":   SlipMarker,
+				"remove-marker": RemoveMarker,
+			}[name]
+
+			out = append(out, &Marker{Op: op, line: x.line, col: x.col})
+			continue
+
+		case "turn":
+			out = append(out, &Turn{x.line, x.col})
+			continue
+		}
+
+		st := kr.stitch(x)
+
+		if st == nil {
+			continue
+		}
+
+		out = append(out, st)
+
+		if n, err := strconv.Atoi(strings.TrimSpace(x.Text)); err == nil && n > 1 {
+			out = append(out, &Number{n, x.line, x.col})
+		}
+	}
+
+	return out
+}
+
+// repeat returns the repeat node for the given repeat element.
+// Returns nil if the group is worked once.
+func (kr *knitmlReader) repeat(x *xmlNode) Node {
+	value, _ := strconv.Atoi(x.attr("value"))
+
+	switch x.attr("until") {
+	case knitmlTimes, "":
+		if value > 1 {
+			return &Number{value, x.line, x.col}
+		}
+
+		return nil
+
+	case knitmlEnd:
+		return &RepeatTo{End: true, line: x.line, col: x.col}
+	case knitmlBeforeEnd:
+		return &RepeatTo{Before: value, End: true, line: x.line, col: x.col}
+	case knitmlMarker:
+		return &RepeatTo{line: x.line, col: x.col}
+	case knitmlBeforeMarker:
+		return &RepeatTo{Before: value, line: x.line, col: x.col}
+	}
+
+	kr.issue(x, "Repeat until %q is not imported; worked once.", x.attr("until"))
+	return nil
+}
+
+// stitch returns the stitch for the given element.
+// Returns nil if it is not a known stitch element.
+func (kr *knitmlReader) stitch(x *xmlNode) *Stitch {
+	name := x.XMLName.Local
+	typ := x.attr("type")
+
+	for _, ks := range knitmlStitches {
+		if ks.elem != name || ks.typ != typ {
+			continue
+		}
+
+		st := &Stitch{Kind: ks.kind, line: x.line, col: x.col}
+
+		if name == "cross-stitches" && (x.attr("first") != "1" || x.attr("next") != "1") {
+			kr.issue(x, "Cross of %s over %s stitches is imported as a 1/1 cross.",
+				x.attr("first"), x.attr("next"))
+		}
+
+		if x.attr("loop-to-work") == "trailing" {
+			st.Mod |= BackLoop
+		}
+
+		switch x.attr("yarn-position") {
+		case "front":
+			st.Mod |= YarnForward
+		case "back":
+			st.Mod |= YarnBackward
+		}
+
+		return st
+	}
+
+	if len(typ) > 0 {
+		kr.issue(x, "Element <%s type=%q> is not imported.", name, typ)
+	} else {
+		kr.issue(x, "Element <%s> is not imported.", name)
+	}
+
+	return nil
+}
+
+// checkCounts compares the stitch count checks of the imported rows with
+// the computed stitch counts.
+func (kr *knitmlReader) checkCounts() {
+	stated := make(map[[2]int]bool)
+
+	for _, row := range kr.p.Rows() {
+		if r := row.Row; r != nil && r.Count > 0 {
+			line, col := r.CountPos()
+			stated[[2]int{line, col}] = true
+		}
+	}
+
+	counts, err := kr.p.StitchCounts()
+
+	if counts == nil {
+		if err != nil {
+			kr.issues = append(kr.issues, &ConvertIssue{Msg: err.Error()})
+		}
+		return
+	}
+
+	errs, _ := err.(CountErrors)
+
+	for _, ce := range errs {
+		if stated[[2]int{ce.Line, ce.Col}] {
+			kr.issues = append(kr.issues, &ConvertIssue{ce.Line, ce.Col, ce.Msg})
+		}
+	}
+}
+
+// readXML reads a generic XML element tree, recording source positions.
+func readXML(r io.Reader) (*xmlNode, error) {
+	var stack []*xmlNode
+	var root *xmlNode
+
+	dec := xml.NewDecoder(r)
+
+	for {
+		line, col := dec.InputPos()
+		tok, err := dec.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch tt := tok.(type) {
+		case xml.StartElement:
+			x := &xmlNode{XMLName: tt.Name, Attrs: tt.Attr, line: line, col: col}
+
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				top.Children = append(top.Children, x)
+			} else if root == nil {
+				root = x
+			}
+
+			stack = append(stack, x)
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(tt)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("Empty document.")
+	}
+
+	return root, nil
+}
@@ -0,0 +1,66 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestKnitML(t *testing.T) {
+	p := MustParse("Lace", `Row 1 RS: Co13 (13 sts)
+		Row 2: P13 (13 sts)
+		Row 3: K2 [Yo K2Tog] 3 Pm @K Ssk to end (11 sts)
+		Rows 4-5: P to m Sm P to end`)
+
+	var buf bytes.Buffer
+
+	issues, err := p.WriteKnitML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) > 0 {
+		t.Fatalf("Unexpected issues: %v", issues)
+	}
+
+	q, issues, err := ReadKnitML("Lace", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) > 0 {
+		t.Fatalf("Unexpected issues: %v", issues)
+	}
+
+	if want, have := p.String(), q.String(); want != have {
+		t.Fatalf("Round trip:\nWant: %s\nHave: %s", want, have)
+	}
+
+	issues, err = MustParse("Unsupported", "Row 1: Co8\nRow 2: {CC} K4Tog ^K ref K2").WriteKnitML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 4 {
+		t.Fatalf("Want 4 issues, have %v", issues)
+	}
+
+	_, issues, err = ReadKnitML("Checks", strings.NewReader(`<pattern>
+  <directions>
+    <row number="1"><cast-on>4</cast-on></row>
+    <row number="2"><knit>4</knit><information><number-of-stitches number="5"/></information></row>
+    <row number="3"><knit>2</knit><decrease type="k5tog"/></row>
+  </directions>
+</pattern>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 2 || issues[0].Line != 5 || issues[1].Line != 4 {
+		t.Fatalf("Unexpected issues: %v", issues)
+	}
+}
@@ -0,0 +1,662 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An Interpretation describes how a fragment of a written pattern was
+// read by the lenient parser.
+type Interpretation struct {
+	Line  int    // Source line of the fragment.
+	Col   int    // Source column of the fragment.
+	Text  string // Fragment as written.
+	As    string // Strict form it was read as. Empty if it was dropped.
+	Guess bool   // Was the fragment ambiguous?
+}
+
+func (i *Interpretation) String() string {
+	verb := "read"
+
+	if i.Guess {
+		verb = "guessed"
+	}
+
+	switch i.As {
+	case "":
+		return fmt.Sprintf("%d:%d %s %q as nothing", i.Line, i.Col, verb, i.Text)
+	case i.Text:
+		return fmt.Sprintf("%d:%d %s %q as a reference", i.Line, i.Col, verb, i.Text)
+	}
+
+	return fmt.Sprintf("%d:%d %s %q as %q", i.Line, i.Col, verb, i.Text, i.As)
+}
+
+// ParseLenient parses a pattern written in prose, using the builtin
+// stitches. See Parser.ParseLenient.
+func ParseLenient(name, pat string) (*Pattern, []*Interpretation, error) {
+	return new(Parser).ParseLenient(name, pat)
+}
+
+// ParseLenient parses a pattern as commonly written in books and on
+// blogs. E.g.:
+//
+//	Row 1 (RS): K2, *p2, k2; rep from * to end. (24 sts)
+//
+// The prose is rewritten into the strict pattern syntax, which is then
+// parsed as usual. Every rewritten fragment is reported, along with
+// whether its meaning had to be guessed. The interpretations are also
+// returned if parsing fails, to help make sense of the error.
+//
+// The following conventions are understood:
+//
+//   - `*` starting a repeat, closed by `rep from *`. The repeat continues
+//     `to end`, `across`, `to last N sts`, `to m`, `N more times` or
+//     `once more`. `N times` is read as N more times and is reported as
+//     a guess, as are repeats which do not state their extent.
+//   - Parentheses holding a side, as in `(RS)` or `(wrong side)`.
+//   - Parentheses holding a stitch count, as in `(24 stitches)`. These
+//     become the stated stitch count of the row.
+//   - Other parentheses group stitches, like brackets do.
+//   - `sl1`, `slip 2 kwise` and similar. Stitches are slipped purlwise,
+//     unless stated otherwise. This is reported as a guess.
+//   - `tbl`, `wyif` and `wyib` following a stitch.
+//   - `knit`, `purl`, `cast on`, `bind off`, `all sts`, `N sts` and
+//     `N times`.
+//
+// Other words which are not known stitches are read as references to
+// other patterns. These are reported as guesses. Source positions refer
+// to the original text, as far as the rewritten form allows.
+func (ps *Parser) ParseLenient(name, pat string) (*Pattern, []*Interpretation, error) {
+	meta, pat, err := parseHeader(name, pat)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reg := ps.Stitches
+
+	if reg == nil {
+		reg = builtin
+	}
+
+	var notes []*Interpretation
+
+	lines := strings.Split(pat, "\n")
+
+	for i, line := range lines {
+		pl := &proseLine{reg: reg, line: i + 1, src: line, stitch: -1}
+		lines[i] = pl.rewrite()
+		notes = append(notes, pl.notes...)
+	}
+
+	p, err := ps.Parse(name, strings.Join(lines, "\n"))
+
+	if err != nil {
+		return nil, notes, err
+	}
+
+	p.Meta = meta
+	return p, notes, nil
+}
+
+// proseWord is a word of a written pattern line, or its rewritten form.
+type proseWord struct {
+	text string
+	col  int // Column the word starts at. 0 if it has no source.
+}
+
+// proseLine rewrites a single line of prose into strict syntax.
+type proseLine struct {
+	reg    *Registry
+	line   int
+	src    string
+	words  []*proseWord
+	out    []*proseWord // Rewritten words. Empty words are dropped.
+	notes  []*Interpretation
+	stars  []int // Word index of every pending `*`.
+	parens []int // Out index of the group opened by every pending `(`.
+	stitch int   // Out index of the last stitch. -1 if there is none.
+}
+
+// rewrite returns the line in strict syntax.
+func (pl *proseLine) rewrite() string {
+	pl.words = splitProse(pl.src)
+
+	for i := 0; i < len(pl.words); {
+		i = pl.word(i)
+	}
+
+	// A `*` which is never repeated is just decoration.
+	for _, i := range pl.stars {
+		pl.note(i, i+1, "", true)
+	}
+
+	sort.SliceStable(pl.notes, func(i, j int) bool {
+		return pl.notes[i].Col < pl.notes[j].Col
+	})
+
+	var sb strings.Builder
+
+	for _, w := range pl.out {
+		if len(w.text) == 0 {
+			continue
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+
+		// Keep words at their original column where possible, so that
+		// parse errors refer to the original text.
+		for sb.Len() < w.col-1 {
+			sb.WriteByte(' ')
+		}
+
+		sb.WriteString(w.text)
+	}
+
+	return sb.String()
+}
+
+// word rewrites the word at index i and returns the index of the next
+// word to process.
+func (pl *proseLine) word(i int) int {
+	w := pl.words[i]
+
+	switch lw := pl.lower(i); {
+	case lw == "(":
+		return pl.paren(i)
+
+	case lw == ")":
+		if n := len(pl.parens); n > 0 {
+			pl.parens = pl.parens[:n-1]
+			pl.emit("]", w.col)
+			return i + 1
+		}
+
+		pl.note(i, i+1, "", true)
+		return i + 1
+
+	case isStars(lw):
+		// The group is only opened once the matching `rep from *` is found.
+		pl.stars = append(pl.stars, i)
+		pl.emit("", w.col)
+		return i + 1
+
+	case (lw == "rep" || lw == "repeat") && pl.lower(i+1) == "from" && isStars(pl.lower(i+2)):
+		return pl.repeat(i)
+
+	case lw == "to":
+		if j, as, ok := pl.target(i); ok {
+			pl.replace(i, j, as, false)
+			return j
+		}
+
+	case lw == "tbl":
+		return pl.modifier(i, BackLoop)
+
+	case lw == "wyif":
+		return pl.modifier(i, YarnForward)
+
+	case lw == "wyib":
+		return pl.modifier(i, YarnBackward)
+
+	case isSlip(lw):
+		return pl.slip(i)
+
+	case lw == "knit" || lw == "purl":
+		pl.replace(i, i+1, strings.ToUpper(lw[:1]), false)
+		pl.stitch = len(pl.out) - 1
+		return i + 1
+
+	case (lw == "cast" && pl.lower(i+1) == "on") || (lw == "bind" && pl.lower(i+1) == "off"):
+		as := "Co"
+
+		if lw == "bind" {
+			as = "Bo"
+		}
+
+		pl.replace(i, i+2, as, false)
+		pl.stitch = len(pl.out) - 1
+		return i + 2
+
+	case (lw == "all" || lw == "rem" || lw == "remaining") && pl.afterUnit():
+		j := i + 1
+
+		if isStitchCount(pl.lower(j)) {
+			j++
+		}
+
+		pl.replace(i, j, "to end", false)
+		return j
+
+	case lw == "across" && pl.afterUnit():
+		pl.replace(i, i+1, "to end", false)
+		return i + 1
+
+	case (lw == "times" || lw == "time") && isNumber(pl.lower(i-1)):
+		pl.note(i, i+1, "", false)
+		return i + 1
+
+	case isStitchCount(lw) && isNumber(pl.lower(i-1)) && pl.lower(i+1) != "before":
+		pl.note(i, i+1, "", false)
+		return i + 1
+
+	case lw == "then" || lw == "and" || lw == "work":
+		pl.note(i, i+1, "", false)
+		return i + 1
+	}
+
+	pl.emit(w.text, w.col)
+
+	switch {
+	case pl.isStitch(w.text):
+		pl.stitch = len(pl.out) - 1
+	case isWord(w.text) && !isKeyword(w.text):
+		pl.note(i, i+1, w.text, true)
+	}
+
+	return i + 1
+}
+
+// paren rewrites the parenthesis at index i, which either holds an
+// annotation or starts a group.
+func (pl *proseLine) paren(i int) int {
+	end := i + 1
+
+	for end < len(pl.words) && pl.words[end].text != ")" && pl.words[end].text != "(" {
+		end++
+	}
+
+	var inner []string
+
+	for k := i + 1; k < end && k < len(pl.words); k++ {
+		inner = append(inner, pl.lower(k))
+	}
+
+	if end < len(pl.words) && pl.words[end].text == ")" {
+		switch v := strings.Join(inner, " "); {
+		case v == "rs" || v == "right side":
+			pl.replace(i, end+1, "RS", false)
+			return end + 1
+
+		case v == "ws" || v == "wrong side":
+			pl.replace(i, end+1, "WS", false)
+			return end + 1
+
+		case len(inner) == 2 && isNumber(inner[0]) && isStitchCount(inner[1]):
+			n, _ := strconv.Atoi(inner[0])
+			pl.replace(i, end+1, (&Row{Count: n}).CountString(), false)
+			return end + 1
+		}
+	}
+
+	pl.parens = append(pl.parens, len(pl.out))
+	pl.emit("[", pl.words[i].col)
+	pl.note(i, i+1, "[", false)
+	return i + 1
+}
+
+// repeat rewrites `rep from *`, at index i, along with the extent of
+// the repeat. It closes the group opened by the matching `*`.
+func (pl *proseLine) repeat(i int) int {
+	j := i + 3
+	n := len(pl.stars)
+
+	if n == 0 {
+		pl.note(i, j, "", true)
+		return j
+	}
+
+	star := pl.stars[n-1]
+	pl.stars = pl.stars[:n-1]
+
+	for k := len(pl.out) - 1; k >= 0; k-- {
+		if w := pl.out[k]; w.text == "" && w.col == pl.words[star].col {
+			w.text = "["
+			break
+		}
+	}
+
+	pl.note(star, star+1, "[", false)
+
+	var as string
+	var guess bool
+
+	next := pl.lower(j)
+
+	if k, target, ok := pl.target(j); ok {
+		as, j = "] "+target, k
+	} else if next == "across" {
+		as, j = "] to end", j+1
+	} else if (next == "once" || next == "twice") && pl.lower(j+1) == "more" {
+		as, j = "]2", j+2
+
+		if next == "twice" {
+			as = "]3"
+		}
+	} else if isNumber(next) {
+		count, _ := strconv.Atoi(next)
+		j++
+
+		more := pl.lower(j) == "more"
+
+		if more {
+			j++
+		}
+
+		if w := pl.lower(j); w == "times" || w == "time" {
+			j++
+		}
+
+		if pl.lower(j) == "more" {
+			more = true
+			j++
+		}
+
+		as, guess = fmt.Sprintf("]%d", count+1), !more
+	} else {
+		as, guess = "] to end", true
+	}
+
+	pl.replace(i, j, as, guess)
+	return j
+}
+
+// target reads the extent of a repeat, starting at `to` at index i.
+// It returns the index following it, along with its strict form.
+func (pl *proseLine) target(i int) (int, string, bool) {
+	j := i + 1
+
+	switch w := pl.lower(j); {
+	case w == "end":
+		j++
+
+		if pl.lower(j) == "of" {
+			j++
+
+			if pl.lower(j) == "the" {
+				j++
+			}
+
+			if tt, ok := keywords[pl.lower(j)]; ok && tt == tokRow {
+				j++
+			}
+		}
+
+		return j, "to end", true
+
+	case w == "last":
+		j++
+		n := "1"
+
+		if isNumber(pl.lower(j)) {
+			n = pl.lower(j)
+			j++
+		}
+
+		if isStitchCount(pl.lower(j)) {
+			j++
+		}
+
+		return j, "to " + n + " before end", true
+	}
+
+	var before string
+
+	if isNumber(pl.lower(j)) {
+		before = pl.lower(j) + " before "
+		j++
+
+		if isStitchCount(pl.lower(j)) {
+			j++
+		}
+
+		if pl.lower(j) != "before" {
+			return 0, "", false
+		}
+
+		j++
+
+		if pl.lower(j) == "end" {
+			return j + 1, "to " + before + "end", true
+		}
+	}
+
+	if w := pl.lower(j); w == "next" || w == "the" {
+		j++
+	}
+
+	if j >= len(pl.words) {
+		return 0, "", false
+	}
+
+	// Keep a marker name, as in `m(A)`.
+	text := pl.words[j].text
+	base, param := text, ""
+
+	if k := strings.Index(text, "("); k > -1 {
+		base, param = text[:k], text[k:]
+	}
+
+	if b := strings.ToLower(base); b != "m" && b != "marker" {
+		return 0, "", false
+	}
+
+	return j + 1, "to " + before + "m" + param, true
+}
+
+// slip rewrites a slipped stitch, at index i. E.g.: `sl1`, `sl 2 kwise`.
+func (pl *proseLine) slip(i int) int {
+	lw := pl.lower(i)
+	count := strings.TrimLeft(lw, "abcdefghijklmnopqrstuvwxyz")
+	j := i + 1
+
+	if len(count) == 0 && isNumber(pl.lower(j)) {
+		count = pl.lower(j)
+		j++
+	}
+
+	as, guess := "Ps", true
+
+	switch pl.lower(j) {
+	case "kwise", "knitwise", "k-wise", "kw":
+		as, guess = "Ks", false
+		j++
+	case "pwise", "purlwise", "p-wise", "pw":
+		guess = false
+		j++
+	}
+
+	pl.replace(i, j, as+count, guess)
+	pl.stitch = len(pl.out) - 1
+	return j
+}
+
+// modifier applies a stitch modifier, written at index i, to the
+// preceding stitch.
+func (pl *proseLine) modifier(i int, mod StitchMod) int {
+	if pl.stitch < 0 || pl.stitch != pl.last() {
+		pl.note(i, i+1, "", true)
+		return i + 1
+	}
+
+	w := pl.out[pl.stitch]
+	w.text = mod.String() + w.text
+
+	if w.col > 1 {
+		w.col--
+	}
+
+	pl.note(i, i+1, mod.String(), false)
+	return i + 1
+}
+
+// afterUnit returns true if the last rewritten word is a stitch or
+// the end of a group.
+func (pl *proseLine) afterUnit() bool {
+	n := pl.last()
+	return n > -1 && (n == pl.stitch || pl.out[n].text == "]")
+}
+
+// last returns the index of the last rewritten word, or -1.
+func (pl *proseLine) last() int {
+	for n := len(pl.out) - 1; n >= 0; n-- {
+		if len(pl.out[n].text) > 0 {
+			return n
+		}
+	}
+
+	return -1
+}
+
+// isStitch returns true if v is a known stitch, optionally preceded by
+// modifiers and followed by a count. E.g.: `@k2tog` or `p12`.
+func (pl *proseLine) isStitch(v string) bool {
+	v = strings.TrimLeft(v, "@^<>&")
+
+	if pl.reg.Lookup(v) != nil {
+		return true
+	}
+
+	v = strings.TrimRight(v, "0123456789")
+	return len(v) > 0 && pl.reg.Lookup(v) != nil
+}
+
+// replace rewrites the words from index i up to j as the given text.
+func (pl *proseLine) replace(i, j int, as string, guess bool) {
+	pl.emit(as, pl.words[i].col)
+	pl.note(i, j, as, guess)
+}
+
+// emit appends a rewritten word.
+func (pl *proseLine) emit(text string, col int) {
+	pl.out = append(pl.out, &proseWord{text, col})
+}
+
+// note records the interpretation of the words from index i up to j.
+// Nothing is recorded if the words were left as they are.
+func (pl *proseLine) note(i, j int, as string, guess bool) {
+	start := pl.words[i].col - 1
+	last := pl.words[j-1]
+	text := pl.src[start : last.col-1+len(last.text)]
+
+	if !guess && strings.EqualFold(strings.Join(strings.Fields(text), " "), as) {
+		return
+	}
+
+	pl.notes = append(pl.notes, &Interpretation{pl.line, start + 1, text, as, guess})
+}
+
+// lower returns the word at index i in lower case, or an empty string
+// if there is no such word.
+func (pl *proseLine) lower(i int) string {
+	if i < 0 || i >= len(pl.words) {
+		return ""
+	}
+
+	return strings.ToLower(pl.words[i].text)
+}
+
+// splitProse splits a line into words. Punctuation is dropped, except
+// for colons. Parentheses, brackets and runs of `*` are words of their
+// own, unless a parenthesis directly follows a word, as in `Pm(A)`.
+// Colour blocks are kept whole.
+func splitProse(line string) []*proseWord {
+	var list []*proseWord
+
+	start := -1
+
+	flush := func(end int) {
+		if start > -1 {
+			list = append(list, &proseWord{line[start:end], start + 1})
+			start = -1
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case isWhitespace(c) || c == ',' || c == ';':
+			flush(i)
+
+		case c == '.' && (start == -1 || i+1 >= len(line) || !isDigit(line[i+1])):
+			flush(i)
+
+		case c == ':' || c == '[' || c == ']' || c == ')' || (c == '(' && start == -1):
+			flush(i)
+			list = append(list, &proseWord{line[i : i+1], i + 1})
+
+		case c == '(':
+			// A parameter, as in `Pm(A)`.
+			end := strings.IndexByte(line[i:], ')')
+
+			if end == -1 {
+				flush(i)
+				list = append(list, &proseWord{"(", i + 1})
+				break
+			}
+
+			i += end
+
+		case c == '{':
+			flush(i)
+			end := strings.IndexByte(line[i:], '}')
+
+			if end == -1 {
+				end = len(line) - i - 1
+			}
+
+			list = append(list, &proseWord{line[i : i+end+1], i + 1})
+			i += end
+
+		case c == '*':
+			if start > -1 && line[start] != '*' {
+				flush(i)
+			}
+
+			if start == -1 {
+				start = i
+			}
+
+		default:
+			if start > -1 && line[start] == '*' {
+				flush(i)
+			}
+
+			if start == -1 {
+				start = i
+			}
+		}
+	}
+
+	flush(len(line))
+	return list
+}
+
+// isKeyword returns true if v is a reserved word.
+func isKeyword(v string) bool {
+	_, ok := keywords[strings.ToLower(v)]
+	return ok
+}
+
+// isStars returns true if v consists of `*` only.
+func isStars(v string) bool {
+	return len(v) > 0 && strings.Trim(v, "*") == ""
+}
+
+// isSlip returns true if v denotes a slipped stitch. E.g.: `sl`, `sl1`.
+func isSlip(v string) bool {
+	name := strings.TrimRight(v, "0123456789")
+	return name == "sl" || name == "slip"
+}
+
+// isNumber returns true if v consists of digits only.
+func isNumber(v string) bool {
+	return len(v) > 0 && strings.Trim(v, "0123456789") == ""
+}
@@ -0,0 +1,56 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLenient(t *testing.T) {
+	p, notes, err := ParseLenient("Rib", `Row 1 (RS): K2, *p2, k2; rep from * to end. (24 sts)
+		Row 2 (WS): sl1 kwise, p1 tbl, *k2tog, yo; rep from * 3 more times, sl1.
+		Row 3: (k1, p1) 3 times, k to last 2 sts, knit 2`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Row1 RS: K2 [P2 K2] to end (24 sts) \nRow2 WS: Ks1 @P1 [K2Tog Yo]4 Ps1 \n" +
+		"Row3: [K1 P1]3 K to 2 before end K2"
+
+	if have := p.String(); have != want {
+		t.Fatalf("Lenient parse:\nWant: %s\nHave: %s", want, have)
+	}
+
+	var guesses []string
+
+	for _, n := range notes {
+		if n.Guess {
+			guesses = append(guesses, n.String())
+		}
+	}
+
+	if want, have := `[2:71 guessed "sl1" as "Ps1"]`, fmt.Sprint(guesses); want != have {
+		t.Fatalf("Guesses:\nWant: %s\nHave: %s", want, have)
+	}
+
+	if len(notes) != 13 {
+		t.Fatalf("Want 13 interpretations, have %d: %v", len(notes), notes)
+	}
+
+	// Nodes keep the position of the prose they were read from.
+	if st := p.Node(3).(*Group); st.Line() != 1 || st.Col() != 17 {
+		t.Fatalf("Want group at 1:17, have %d:%d", st.Line(), st.Col())
+	}
+
+	_, notes, err = ParseLenient("Guess", "Row 1: *k2, p2; rep from *, foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notes) != 3 || !notes[1].Guess || !notes[2].Guess {
+		t.Fatalf("Unexpected interpretations: %v", notes)
+	}
+}
@@ -4,7 +4,6 @@
 package knit
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"strings"
@@ -13,6 +12,7 @@ import (
 // lexer is a lexer for knitting pattern strings.
 type lexer struct {
 	out      chan *token // Output channel for parsed tokens.
+	stitches *Registry   // Known stitch kinds.
 	data     string      // Input pattern string.
 	line     [2]int      // Current line and line where token started.
 	col      [2]int      // Current column and column where token started.
@@ -22,13 +22,15 @@ type lexer struct {
 }
 
 // lex reads the input data and turns it into a stream of tokens.
-// tokens are sent over the returned channel.
-func lex(data string) <-chan *token {
+// tokens are sent over the returned channel. The registry determines
+// which stitch names may contain characters other than letters.
+func lex(data string, stitches *Registry) <-chan *token {
 	l := new(lexer)
+	l.stitches = stitches
 
-	if sz := len(data); sz == 0 {
-		l.data = "\n"
-	} else if data[sz-1] != '\n' {
+	l.data = data
+
+	if sz := len(data); sz == 0 || data[sz-1] != '\n' {
 		l.data = data + "\n"
 	}
 
@@ -51,14 +53,43 @@ func lex(data string) <-chan *token {
 	return l.out
 }
 
-func (l *lexer) step() bool {
-	l.whitespace()
+// lookahead buffers the tokens produced by a lexer, so the parser can
+// look at the tokens following the current one.
+type lookahead struct {
+	tokens <-chan *token // Tokens produced by the lexer.
+	buf    []*token      // Tokens read ahead.
+}
 
-	if l.literal("row") {
-		l.emit(tokRow)
-		return true
+// next returns the next token. It yields nil once the lexer is done.
+func (la *lookahead) next() *token {
+	if len(la.buf) == 0 {
+		return <-la.tokens
+	}
+
+	tok := la.buf[0]
+	la.buf = la.buf[1:]
+	return tok
+}
+
+// peek returns the token i places after the one last returned by next,
+// without consuming it. It yields nil past the end of the input.
+func (la *lookahead) peek(i int) *token {
+	for len(la.buf) <= i {
+		tok := <-la.tokens
+
+		if tok == nil {
+			return nil
+		}
+
+		la.buf = append(la.buf, tok)
 	}
 
+	return la.buf[i]
+}
+
+func (l *lexer) step() bool {
+	l.whitespace()
+
 	if l.modifier() {
 		return true
 	}
@@ -80,6 +111,13 @@ func (l *lexer) step() bool {
 	case ']':
 		l.emit(tokGroupEnd)
 		return true
+	case '{':
+		return l.color()
+	case '(':
+		return l.param()
+	case '-':
+		l.emit(tokRange)
+		return true
 
 	// Punctuation sometimes used by users.
 	// Don't consider it an error, just ignore it.
@@ -100,7 +138,13 @@ func (l *lexer) error(f string, argv ...interface{}) {
 
 // emit emits a new token.
 func (l *lexer) emit(tt tokenType) {
-	l.out <- &token{tt, l.data[l.start:l.pos], l.line[1], l.col[1]}
+	l.emitValue(tt, l.data[l.start:l.pos])
+}
+
+// emitValue emits a new token with the given data, instead of
+// the raw token input.
+func (l *lexer) emitValue(tt tokenType, v string) {
+	l.out <- &token{tt, v, l.line[1], l.col[1]}
 	l.ignore()
 }
 
@@ -189,18 +233,46 @@ func (l *lexer) number() bool {
 		n++
 	}
 
-	if n > 0 {
-		l.emit(tokNumber)
-		return true
+	if n == 0 {
+		return false
 	}
 
-	return false
+	// A decimal fraction, as used in measurements. E.g.: `7.5cm`.
+	if l.pos+1 < len(l.data) && l.data[l.pos] == '.' && isDigit(l.data[l.pos+1]) {
+		l.next()
+
+		for {
+			b, err := l.next()
+
+			if err != nil {
+				return false
+			}
+
+			if !isDigit(b) {
+				l.rewind()
+				break
+			}
+		}
+	}
+
+	l.emit(tokNumber)
+	return true
 }
 
 // ident consumes bytes for as long as they qualify as an ident.
+// Keywords are emitted as their own token types.
 func (l *lexer) ident() bool {
 	var n int
 
+	if n = l.stitchName(); n > 0 {
+		for ; n > 0; n-- {
+			l.next()
+		}
+
+		l.emit(tokStitch)
+		return true
+	}
+
 	for {
 		b, err := l.next()
 
@@ -216,12 +288,52 @@ func (l *lexer) ident() bool {
 		n++
 	}
 
-	if n > 0 {
+	if n == 0 {
+		return false
+	}
+
+	if tt, ok := keywords[strings.ToLower(l.data[l.start:l.pos])]; ok {
+		l.emit(tt)
+	} else {
 		l.emit(tokStitch)
-		return true
 	}
 
-	return false
+	return true
+}
+
+// stitchName returns the length of the longest known stitch name at the
+// current position, which contains characters other than letters.
+// E.g.: `k2tog`, `yo2` or `w&t`. Returns 0 if there is no such name.
+//
+// A name ending in a digit must not be directly followed by another
+// digit. This keeps `yo23` a quantified `yo`, rather than `yo2` followed
+// by the number 3.
+func (l *lexer) stitchName() int {
+	end := l.pos
+
+	if end >= len(l.data) || !isLetter(l.data[end]) {
+		return 0
+	}
+
+	for end < len(l.data) && isNameChar(l.data[end]) {
+		end++
+	}
+
+	for ; end > l.pos; end-- {
+		v := l.data[l.pos:end]
+
+		if isWord(v) || l.stitches.Lookup(v) == nil {
+			continue
+		}
+
+		if isDigit(v[len(v)-1]) && end < len(l.data) && isDigit(l.data[end]) {
+			continue
+		}
+
+		return end - l.pos
+	}
+
+	return 0
 }
 
 // modifier consumes bytes for as long as they qualify as a known modifier.
@@ -241,45 +353,72 @@ func (l *lexer) modifier() bool {
 	return false
 }
 
-// literal consumes bytes for as long as they are a byte-for-byte
-// match with the given string literal. If there is no match, the
-// reader is restored to the original position.
-//
-// The match is case insensitive.
-func (l *lexer) literal(v string) bool {
-	var err error
+// color consumes a colour block, after its opening brace has been read.
+// E.g.: `{CC1}` or `{CC1: navy}`. It emits the text between the braces.
+func (l *lexer) color() bool {
+	for {
+		b, err := l.next()
 
-	pos := l.pos
-	line := l.line[0]
-	col := l.col[0]
-	b := make([]byte, 1)
+		if err != nil {
+			return false
+		}
 
-	v = strings.ToLower(v)
+		switch b {
+		case '}':
+			v := l.data[l.start+1 : l.pos-1]
+			l.emitValue(tokColor, strings.TrimSpace(v))
+			return true
+
+		case '\n', '{':
+			l.error("Unterminated colour block")
+			return false
+		}
+	}
+}
 
-	for i := range v {
-		b[0], err = l.next()
+// param consumes a parameter block, after its opening parenthesis has
+// been read. E.g.: the marker name in `Pm(A)`. It emits the text between
+// the parentheses.
+func (l *lexer) param() bool {
+	for {
+		b, err := l.next()
 
 		if err != nil {
 			return false
 		}
 
-		b = bytes.ToLower(b)
+		switch b {
+		case ')':
+			v := l.data[l.start+1 : l.pos-1]
+			l.emitValue(tokParam, strings.TrimSpace(v))
+			return true
 
-		if b[0] != v[i] {
-			l.pos = pos
-			l.line[0] = line
-			l.col[0] = col
+		case '\n', '(':
+			l.error("Unterminated parameter block")
 			return false
 		}
 	}
-
-	return true
 }
 
 func isLetter(v byte) bool {
 	return (v >= 'a' && v <= 'z') || (v >= 'A' && v <= 'Z')
 }
 
+// isNameChar returns true if v can be part of a stitch name.
+func isNameChar(v byte) bool {
+	return isLetter(v) || isDigit(v) || v == '&'
+}
+
+// isWord returns true if v consists of letters only.
+func isWord(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if !isLetter(v[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func isWhitespace(v byte) bool {
 	switch v {
 	case ' ', '\n', '\t', '\v', '\f', '\r', 0x85, 0xA0:
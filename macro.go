@@ -0,0 +1,169 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "fmt"
+
+// macros lists the expansions of builtin stitch kinds which are
+// shorthand for a sequence of simpler stitches.
+var macros = map[StitchKind]string{
+	KnitFrontBack:  "K &@K",
+	PurlFrontBack:  "P &@P",
+	S2kp:           "Ks2 K Psso2",
+	Sk2p:           "Ks K2Tog Psso",
+	DoubleYarnOver: "Yo Yo",
+}
+
+// sequenceCounts returns the number of stitches consumed from the left
+// needle and produced on the right needle by working the given nodes
+// in sequence.
+func sequenceCounts(nodes []Node) (consumes, produces int) {
+	var c, p int
+
+	for _, node := range nodes {
+		switch tt := node.(type) {
+		case *Stitch:
+			c, p = tt.Consumes(), tt.Produces()
+
+		case *Group:
+			c, p = sequenceCounts(tt.Nodes())
+
+		case *Number:
+			consumes += c * (tt.Value - 1)
+			produces += p * (tt.Value - 1)
+			continue
+
+		default:
+			c, p = 0, 0
+		}
+
+		consumes += c
+		produces += p
+	}
+
+	return
+}
+
+// Lower replaces every macro stitch in the pattern with the sequence of
+// stitches it expands to. This is repeated until no macro stitches remain.
+// Which stitches are macros is determined by the given registry. If it is
+// nil, the builtin stitches are used.
+//
+// The expanded stitches take on the source position and colour of the
+// macro stitch they replace. A quantified macro stitch becomes a group
+// with the same quantifier. Macro stitches carrying modifiers can not
+// be lowered, as there is no telling which expanded stitch they apply to.
+func (p *Pattern) Lower(r *Registry) error {
+	if r == nil {
+		r = builtin
+	}
+
+	cache := make(map[*StitchDef]*Group)
+	err := recursive_lower(p.Group, r, cache)
+
+	if err != nil {
+		return fmt.Errorf("Lower %q: %v", p.Name, err)
+	}
+
+	return nil
+}
+
+// recursive_lower recursively replaces macro stitches in the given group.
+func recursive_lower(list *Group, r *Registry, cache map[*StitchDef]*Group) error {
+	var out []Node
+
+	nodes := list.Nodes()
+
+	for i, node := range nodes {
+		switch tt := node.(type) {
+		case *Group:
+			if err := recursive_lower(tt, r, cache); err != nil {
+				return err
+			}
+
+		case *Stitch:
+			def := tt.Def
+
+			if def == nil {
+				def = r.Def(tt.Kind)
+			}
+
+			if def == nil || len(def.Expand) == 0 {
+				break
+			}
+
+			if tt.Mod != 0 {
+				return fmt.Errorf("%d:%d Can not lower %q with modifiers %q.",
+					tt.line, tt.col, def.Name, tt.Mod)
+			}
+
+			g, err := expansion(def, r, cache)
+
+			if err != nil {
+				return err
+			}
+
+			g = recursive_copy(g, list)
+			recursive_place(g, tt)
+
+			if err = recursive_lower(g, r, cache); err != nil {
+				return err
+			}
+
+			if isRepeat(nodeAt(nodes, i+1)) {
+				out = append(out, g)
+				continue
+			}
+
+			for _, n := range g.Nodes() {
+				if sub, ok := n.(*Group); ok {
+					sub.parent = list
+				}
+
+				out = append(out, n)
+			}
+
+			continue
+		}
+
+		out = append(out, node)
+	}
+
+	list.SetNodes(out)
+	return nil
+}
+
+// expansion returns the parsed expansion for the given macro stitch.
+func expansion(def *StitchDef, r *Registry, cache map[*StitchDef]*Group) (*Group, error) {
+	if g, ok := cache[def]; ok {
+		return g, nil
+	}
+
+	p, err := (&Parser{Stitches: r}).Parse(def.Name, def.Expand)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cache[def] = p.Group
+	return p.Group, nil
+}
+
+// recursive_place gives all nodes in the group the source position
+// and colour of the given stitch.
+func recursive_place(list *Group, st *Stitch) {
+	list.line, list.col = st.line, st.col
+
+	for _, node := range list.Nodes() {
+		switch tt := node.(type) {
+		case *Group:
+			recursive_place(tt, st)
+		case *Stitch:
+			tt.line, tt.col = st.line, st.col
+			tt.Color = st.Color
+		case *Number:
+			tt.line, tt.col = st.line, st.col
+		}
+	}
+}
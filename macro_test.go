@@ -0,0 +1,78 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "testing"
+
+func TestLower(t *testing.T) {
+	// Builtin macros must work the same number of stitches as the
+	// stitch they expand.
+	for _, def := range builtin.Defs() {
+		if len(def.Expand) == 0 {
+			continue
+		}
+
+		if err := builtin.checkExpansion(def); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := Parse("Lower", "{CC1} Kfb 2 Sk2p K")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Lower(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[{CC1} K @&K]2 Ks K2Tog Psso K"
+
+	if have := p.String(); have != want {
+		t.Fatalf("Lower: Want %q, have %q", want, have)
+	}
+
+	if err := MustParse("Modified", "@Kfb").Lower(nil); err == nil {
+		t.Fatal("Expected error for macro stitch with modifiers")
+	}
+
+	// A custom macro must work as many stitches as it states.
+	ps := NewParser()
+
+	_, err = ps.Stitches.Register(StitchDef{
+		Name:     "Nupp5",
+		Title:    "Five stitch nupp",
+		Consumes: 1,
+		Produces: 5,
+		Symbol:   '*',
+		Expand:   "K Yo &K Yo &K",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ps.Stitches.Register(StitchDef{
+		Name:     "Nupp3",
+		Consumes: 1,
+		Produces: 3,
+		Expand:   "[K Yo] 2 K",
+	})
+
+	if err == nil {
+		t.Fatal("Expected error for expansion working 3/5 stitches")
+	}
+
+	p = ps.MustParse("Nupps", "K2 Nupp5 K2")
+
+	if err = p.Lower(ps.Stitches); err != nil {
+		t.Fatal(err)
+	}
+
+	want = "K2 K Yo &K Yo &K K2"
+
+	if have := p.String(); have != want {
+		t.Fatalf("Lower: Want %q, have %q", want, have)
+	}
+}
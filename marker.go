@@ -0,0 +1,425 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MarkerOp defines what is done with a stitch marker.
+type MarkerOp uint8
+
+// Known marker operations.
+const (
+	PlaceMarker  MarkerOp = iota // Place a new marker on the right needle.
+	SlipMarker                   // Move the next marker to the right needle.
+	RemoveMarker                 // Remove the next marker.
+)
+
+// String returns the abbreviation for the given marker operation.
+func (m MarkerOp) String() string {
+	switch m {
+	case PlaceMarker:
+		return "Pm"
+	case SlipMarker:
+		return "Sm"
+	case RemoveMarker:
+		return "Rm"
+	}
+
+	panic("unreachable")
+}
+
+// getMarkerOp returns the marker operation for the given string.
+func getMarkerOp(v string) MarkerOp {
+	switch strings.ToLower(v) {
+	case "sm":
+		return SlipMarker
+	case "rm":
+		return RemoveMarker
+	}
+
+	return PlaceMarker
+}
+
+// A Marker node places, slips or removes a stitch marker. Markers can
+// optionally be named, to tell them apart. E.g.: `Pm(A)`.
+type Marker struct {
+	Op   MarkerOp
+	Name string // Optional marker name.
+	line int
+	col  int
+}
+
+// Line returns the original pattern source line number for this node.
+func (m *Marker) Line() int { return m.line }
+
+// Col returns the original pattern source column number for this node.
+func (m *Marker) Col() int { return m.col }
+
+func (m *Marker) String() string {
+	if len(m.Name) == 0 {
+		return m.Op.String()
+	}
+
+	return fmt.Sprintf("%s(%s)", m.Op, m.Name)
+}
+
+// A RepeatTo node repeats the preceding stitch or group until a given
+// number of stitches before the next marker, or the end of the row.
+// It takes the place of a Number. For example:
+//
+//	K to m             Knit to the next marker.
+//	K to 2 before m(A) Knit to 2 stitches before marker A.
+//	[K P] to end       Repeat K P up to the end of the row.
+//
+// The actual repeat count depends on the live stitches on the needle.
+// Call Pattern.ResolveMarkers to compute it.
+type RepeatTo struct {
+	Before int    // Number of stitches to leave before the target.
+	End    bool   // Repeat up to the end of the row, instead of a marker.
+	Name   string // Name of the target marker. Empty for the next marker.
+	line   int
+	col    int
+}
+
+// Line returns the original pattern source line number for this node.
+func (r *RepeatTo) Line() int { return r.line }
+
+// Col returns the original pattern source column number for this node.
+func (r *RepeatTo) Col() int { return r.col }
+
+func (r *RepeatTo) String() string {
+	s := "to "
+
+	if r.Before > 0 {
+		s += fmt.Sprintf("%d before ", r.Before)
+	}
+
+	switch {
+	case r.End:
+		return s + "end"
+	case len(r.Name) > 0:
+		return s + "m(" + r.Name + ")"
+	}
+
+	return s + "m"
+}
+
+// isRepeat returns true if the given node repeats the element before it.
+func isRepeat(node Node) bool {
+	switch node.(type) {
+	case *Number, *RepeatTo:
+		return true
+	}
+
+	return false
+}
+
+// repeatStage returns the parsing stage of a RepeatTo node, after a
+// token of the given type has been read. Refer to continuesRepeat.
+func repeatStage(tt tokenType) int {
+	switch tt {
+	case tokNumber:
+		return 1
+	case tokSts:
+		return 2
+	case tokBefore:
+		return 3
+	}
+
+	return 0
+}
+
+// continuesRepeat returns true if a token of the given type can follow
+// the given parsing stage of a RepeatTo node: `to [N [sts] before] m|end`.
+func continuesRepeat(tt tokenType, stage int) bool {
+	switch stage {
+	case 0:
+		return tt == tokNumber || tt == tokTarget
+	case 1:
+		return tt == tokSts || tt == tokBefore
+	case 2:
+		return tt == tokBefore
+	}
+
+	return tt == tokTarget
+}
+
+// needleItem is a single item on a needle: either a stitch or a marker.
+type needleItem struct {
+	marker bool
+	name   string
+}
+
+// ResolveMarkers unrolls the pattern and replaces every RepeatTo node
+// with the concrete number of repeats, based on the positions of the
+// markers among the live stitches. The pattern is modified in place, as
+// with Pattern.Unroll. Use Pattern.Unrolled for a resolved copy.
+//
+// The live stitches are tracked from the start of the pattern. Markers
+// which are passed by a stitch without an explicit slip, are slipped
+// along automatically. If the first row does not cast on, it is assumed
+// the needle holds exactly the number of stitches that row works and
+// no markers.
+func (p *Pattern) ResolveMarkers() error {
+	var held [2][]needleItem
+	var left []needleItem
+
+	p.Unroll()
+
+	rows := p.Rows()
+
+	if len(rows) > 0 && !castsOn(rows[0].Nodes) {
+		n, _ := sequenceCounts(rows[0].Nodes)
+		left = make([]needleItem, n)
+	}
+
+	for i, row := range rows {
+		var right []needleItem
+
+		dir := 0
+
+		if row.Side == WrongSide {
+			dir = 1
+		}
+
+		left = append(left, held[dir]...)
+		held[dir] = nil
+
+		nodes, err := resolveRow(row.Nodes, &left, &right)
+
+		if err != nil {
+			return fmt.Errorf("ResolveMarkers %q: Row %d: %v", p.Name, i+1, err)
+		}
+
+		row.Nodes = nodes
+
+		if row.Short {
+			held[dir] = left
+		} else {
+			// Markers past the last stitch of the row stay at the
+			// end of the row.
+			for _, item := range left {
+				if item.marker {
+					right = append(right, item)
+				}
+			}
+		}
+
+		// Turning the work reverses the order of the stitches on the
+		// needle. In the round, work continues in the same order.
+		left = right
+
+		if !row.Round {
+			for a, b := 0, len(left)-1; a < b; a, b = a+1, b-1 {
+				left[a], left[b] = left[b], left[a]
+			}
+		}
+	}
+
+	var nodes []Node
+
+	for _, row := range rows {
+		if row.Row != nil {
+			nodes = append(nodes, row.Row)
+		}
+
+		nodes = append(nodes, row.Nodes...)
+	}
+
+	p.SetNodes(nodes)
+	return nil
+}
+
+// resolveRow works the given row nodes, moving stitches from the left
+// to the right needle. It returns the row nodes, with RepeatTo nodes
+// replaced by concrete repeats.
+func resolveRow(nodes []Node, left, right *[]needleItem) ([]Node, error) {
+	var out []Node
+
+	for i := 0; i < len(nodes); i++ {
+		switch tt := nodes[i].(type) {
+		case *Stitch:
+			if rt, ok := nodeAt(nodes, i+1).(*RepeatTo); ok {
+				list, err := repeatTo(tt, []Node{tt}, rt, left, right)
+
+				if err != nil {
+					return nil, err
+				}
+
+				out = append(out, list...)
+				i++
+				continue
+			}
+
+			if err := work(tt, left, right); err != nil {
+				return nil, err
+			}
+
+		case *Group:
+			rt, ok := nodeAt(nodes, i+1).(*RepeatTo)
+
+			if !ok {
+				return nil, fmt.Errorf("%d:%d Unexpected group.", tt.line, tt.col)
+			}
+
+			list, err := repeatTo(tt, tt.Nodes(), rt, left, right)
+
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, list...)
+			i++
+			continue
+
+		case *Marker:
+			if err := moveMarker(tt, left, right); err != nil {
+				return nil, err
+			}
+		}
+
+		out = append(out, nodes[i])
+	}
+
+	return out, nil
+}
+
+// repeatTo repeats the given nodes of rep until the target of rt is
+// reached and returns the repeated nodes.
+func repeatTo(rep Node, elem []Node, rt *RepeatTo, left, right *[]needleItem) ([]Node, error) {
+	var out []Node
+
+	distance := -1
+
+	if rt.End {
+		distance = stitchesIn(*left)
+	} else {
+		for i, item := range *left {
+			if item.marker && (len(rt.Name) == 0 || strings.EqualFold(item.name, rt.Name)) {
+				distance = stitchesIn((*left)[:i])
+				break
+			}
+		}
+	}
+
+	if distance == -1 {
+		return nil, fmt.Errorf("%d:%d No marker found for %q.", rt.line, rt.col, rt)
+	}
+
+	distance -= rt.Before
+	step, _ := sequenceCounts(elem)
+
+	if step <= 0 || distance < 0 || distance%step != 0 {
+		return nil, fmt.Errorf("%d:%d Can not work %d stitches in steps of %d for %q.",
+			rt.line, rt.col, distance, step, rt)
+	}
+
+	total := distance / step
+
+	for n := 1; n <= total; n++ {
+		for _, node := range elem {
+			node = copyNode(node)
+
+			if total > 1 {
+				recursive_repeat(node, Repeat{rep, n, total})
+			}
+
+			if st, ok := node.(*Stitch); ok {
+				if err := work(st, left, right); err != nil {
+					return nil, err
+				}
+			} else if m, ok := node.(*Marker); ok {
+				if err := moveMarker(m, left, right); err != nil {
+					return nil, err
+				}
+			}
+
+			out = append(out, node)
+		}
+	}
+
+	return out, nil
+}
+
+// work moves the stitches consumed and produced by st from the left
+// to the right needle. Markers in the way are slipped along. A stitch
+// producing a negative count, like PassOver, lifts stitches off the
+// right needle instead.
+func work(st *Stitch, left, right *[]needleItem) error {
+	for n := st.Consumes(); n > 0; {
+		if len(*left) == 0 {
+			return fmt.Errorf("%d:%d No stitches left to work %s.", st.line, st.col, st.Name())
+		}
+
+		item := (*left)[0]
+		*left = (*left)[1:]
+
+		if item.marker {
+			*right = append(*right, item)
+		} else {
+			n--
+		}
+	}
+
+	for n := st.Produces(); n > 0; n-- {
+		*right = append(*right, needleItem{})
+	}
+
+	for n := st.Produces(); n < 0; n++ {
+		i := len(*right) - 1
+
+		for i >= 0 && (*right)[i].marker {
+			i--
+		}
+
+		if i < 0 {
+			return fmt.Errorf("%d:%d No stitch to pass over.", st.line, st.col)
+		}
+
+		*right = append((*right)[:i], (*right)[i+1:]...)
+	}
+
+	return nil
+}
+
+// moveMarker performs the given marker operation.
+func moveMarker(m *Marker, left, right *[]needleItem) error {
+	if m.Op == PlaceMarker {
+		*right = append(*right, needleItem{true, m.Name})
+		return nil
+	}
+
+	if len(*left) == 0 || !(*left)[0].marker {
+		return fmt.Errorf("%d:%d No marker to %s.", m.line, m.col,
+			strings.ToLower(m.Op.String()))
+	}
+
+	if len(m.Name) > 0 && !strings.EqualFold((*left)[0].name, m.Name) {
+		return fmt.Errorf("%d:%d Expected marker %q, found %q.",
+			m.line, m.col, m.Name, (*left)[0].name)
+	}
+
+	if m.Op == SlipMarker {
+		*right = append(*right, (*left)[0])
+	}
+
+	*left = (*left)[1:]
+	return nil
+}
+
+// stitchesIn returns the number of stitches in the given needle items.
+func stitchesIn(list []needleItem) int {
+	var n int
+
+	for _, item := range list {
+		if !item.marker {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,81 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkers(t *testing.T) {
+	p, err := Parse("Markers", `Row 1: Co20
+		Row 2: P5 Pm P10 Pm(A) P5
+		Row 3: K to 1 before m(A) M1R K Sm(A) K to m Rm K to end
+		Row 4: [P2] to 1 st before m P Sm [P3] to end`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Row3: K to 1 before m(A) M1R K Sm(A) K to m Rm K to end"
+
+	if have := strings.TrimSpace(strings.Split(p.String(), "\n")[2]); have != want {
+		t.Fatalf("String:\nWant: %s\nHave: %s", want, have)
+	}
+
+	counts, err := p.StitchCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rc := counts[2]; rc.Worked != 20 || rc.After != 21 {
+		t.Fatalf("Row 3: Want 20 sts worked into 21, have %d into %d",
+			rc.Worked, rc.After)
+	}
+
+	q := p.Copy()
+
+	if err = q.ResolveMarkers(); err != nil {
+		t.Fatal(err)
+	}
+
+	want = "Row4: " + strings.Repeat("P ", 15) + "Sm" + strings.Repeat(" P", 6)
+
+	if have := strings.TrimSpace(strings.Split(q.String(), "\n")[3]); have != want {
+		t.Fatalf("ResolveMarkers:\nWant: %s\nHave: %s", want, have)
+	}
+
+	for _, pat := range []string{"K to 2", "K to 2 before", "Pm to m", "K to m 3", "Pm(A)(B)"} {
+		if _, err = Parse("Invalid", pat); err == nil {
+			t.Fatalf("Parse %q: Expected an error", pat)
+		}
+	}
+
+	// A marker at the end of a row is kept when the work is turned.
+	q = MustParse("Edge", "Row: Pm K10\nRow: P10\nRow: K to m")
+
+	if err = q.ResolveMarkers(); err != nil {
+		t.Fatalf("ResolveMarkers: %v", err)
+	}
+
+	err = MustParse("Missing", "Row 1: Co4\nRow 2: P to m(B)").Validate()
+
+	if err == nil {
+		t.Fatal("Validate: Expected missing marker error")
+	}
+
+	// Out of context, marker keywords are references.
+	for pat, i := range map[string]int{
+		"Row: K2 end P2": 3,
+		"Row: st":        1,
+		"Row: Edge M":    2,
+		"Pm K2":          0,
+	} {
+		p = MustParse("References", pat)
+
+		if _, ok := p.Node(i).(*Reference); !ok {
+			t.Fatalf("%q: Node %d: Want a reference, have %T", pat, i, p.Node(i))
+		}
+	}
+}
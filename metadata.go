@@ -0,0 +1,240 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Metadata holds descriptive information about a pattern. It is declared
+// in an optional header at the start of the pattern source, enclosed in
+// lines holding `---`. Each header line holds a key and its value:
+//
+//	---
+//	Title: Seed stitch scarf
+//	Designer: A. Knitter
+//	License: CC BY 4.0
+//	Yarn: Worsted
+//	Fibre: 100% wool
+//	Needles: 4.5mm, 5mm
+//	Gauge: 18 sts x 24 rows = 10cm
+//	Measurements: width 20cm, length 150cm
+//	---
+//
+// Keys are case insensitive. All of them are optional.
+type Metadata struct {
+	Title        string         `json:"title,omitempty"`        // Title of the pattern.
+	Designer     string         `json:"designer,omitempty"`     // Name of the designer.
+	License      string         `json:"license,omitempty"`      // License the pattern is published under.
+	Yarn         YarnWeight     `json:"yarn,omitempty"`         // Yarn weight category.
+	Fibre        string         `json:"fibre,omitempty"`        // Yarn fibre content. E.g.: "80% wool, 20% nylon".
+	Needles      []float64      `json:"needles,omitempty"`      // Needle sizes, in millimetres.
+	Gauge        *Gauge         `json:"gauge,omitempty"`        // Gauge the pattern is designed for.
+	Measurements []*Measurement `json:"measurements,omitempty"` // Finished measurements.
+}
+
+// A Measurement is a single named finished measurement. E.g.: chest 90cm.
+type Measurement struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  Unit    `json:"unit"`
+}
+
+func (m *Measurement) String() string {
+	return m.Name + " " + formatLength(m.Value, m.Unit)
+}
+
+// String returns the header in its source form, including the
+// enclosing `---` lines. Unset fields are omitted.
+func (m *Metadata) String() string {
+	list := []string{"---"}
+
+	add := func(key, value string) {
+		if len(value) > 0 {
+			list = append(list, key+": "+value)
+		}
+	}
+
+	add("Title", m.Title)
+	add("Designer", m.Designer)
+	add("License", m.License)
+
+	if m.Yarn != UnknownWeight {
+		add("Yarn", m.Yarn.String())
+	}
+
+	add("Fibre", m.Fibre)
+
+	needles := make([]string, len(m.Needles))
+
+	for i, n := range m.Needles {
+		needles[i] = strconv.FormatFloat(n, 'f', -1, 64) + "mm"
+	}
+
+	add("Needles", strings.Join(needles, ", "))
+
+	if m.Gauge != nil {
+		add("Gauge", m.Gauge.String())
+	}
+
+	sizes := make([]string, len(m.Measurements))
+
+	for i, ms := range m.Measurements {
+		sizes[i] = ms.String()
+	}
+
+	add("Measurements", strings.Join(sizes, ", "))
+	return strings.Join(append(list, "---"), "\n")
+}
+
+// copy returns a deep copy of the metadata.
+func (m *Metadata) copy() *Metadata {
+	c := *m
+	c.Needles = append([]float64(nil), m.Needles...)
+	c.Measurements = nil
+
+	if m.Gauge != nil {
+		g := *m.Gauge
+		c.Gauge = &g
+	}
+
+	for _, ms := range m.Measurements {
+		v := *ms
+		c.Measurements = append(c.Measurements, &v)
+	}
+
+	return &c
+}
+
+// set assigns the value of a single header line.
+func (m *Metadata) set(key, value string) error {
+	var err error
+
+	switch strings.ToLower(key) {
+	case "title":
+		m.Title = value
+	case "designer":
+		m.Designer = value
+	case "license":
+		m.License = value
+	case "fibre", "fiber":
+		m.Fibre = value
+
+	case "yarn":
+		var ok bool
+
+		if m.Yarn, ok = getYarnWeight(value); !ok {
+			return fmt.Errorf("Unknown yarn weight %q", value)
+		}
+
+	case "needles":
+		m.Needles = nil
+
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSuffix(strings.TrimSpace(v), "mm")
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+
+			if err != nil || n <= 0 {
+				return fmt.Errorf("Invalid needle size %q", v)
+			}
+
+			m.Needles = append(m.Needles, n)
+		}
+
+	case "gauge":
+		g, err := ParseGauge(value)
+
+		if err != nil {
+			return err
+		}
+
+		m.Gauge = &g
+
+	case "measurements":
+		m.Measurements = nil
+
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			i := strings.IndexFunc(v, func(r rune) bool { return r >= '0' && r <= '9' })
+
+			if i < 1 {
+				return fmt.Errorf("Invalid measurement %q", v)
+			}
+
+			ms := &Measurement{Name: strings.TrimSpace(v[:i])}
+
+			if ms.Value, ms.Unit, err = parseLength(v[i:]); err != nil {
+				return err
+			}
+
+			m.Measurements = append(m.Measurements, ms)
+		}
+
+	default:
+		return fmt.Errorf("Unknown header key %q", key)
+	}
+
+	return nil
+}
+
+// parseHeader reads the optional metadata header at the start of the
+// given pattern source. It returns the metadata, or nil if there is no
+// header, along with the remaining source. Header lines are blanked out
+// in the remaining source, so line numbers remain intact.
+func parseHeader(name, pat string) (*Metadata, string, error) {
+	lines := strings.Split(pat, "\n")
+	start := 0
+
+	for start < len(lines) && len(strings.TrimSpace(lines[start])) == 0 {
+		start++
+	}
+
+	if start == len(lines) || strings.TrimSpace(lines[start]) != "---" {
+		return nil, pat, nil
+	}
+
+	m := new(Metadata)
+	seen := make(map[string]bool)
+
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		col := strings.Index(lines[i], line) + 1
+
+		if line == "---" {
+			for k := start; k <= i; k++ {
+				lines[k] = ""
+			}
+
+			return m, strings.Join(lines, "\n"), nil
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+
+		sep := strings.Index(line, ":")
+
+		if sep < 1 {
+			return nil, "", fmt.Errorf("%s:%d:%d Expected header key and value, found %q,",
+				name, i+1, col, line)
+		}
+
+		key := strings.TrimSpace(line[:sep])
+
+		if seen[strings.ToLower(key)] {
+			return nil, "", fmt.Errorf("%s:%d:%d Duplicate header key %q,",
+				name, i+1, col, key)
+		}
+
+		seen[strings.ToLower(key)] = true
+
+		if err := m.set(key, strings.TrimSpace(line[sep+1:])); err != nil {
+			return nil, "", fmt.Errorf("%s:%d:%d %v,", name, i+1, col, err)
+		}
+	}
+
+	return nil, "", fmt.Errorf("%s:%d:1 Unterminated header,", name, start+1)
+}
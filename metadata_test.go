@@ -0,0 +1,75 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	src := `---
+Title: Seed stitch scarf
+Designer: A. Knitter
+Yarn: Worsted
+Fibre: 100% wool
+Needles: 4.5mm, 5mm
+Gauge: 18 sts x 24 rows = 10cm
+Measurements: width 20cm, length 150cm
+---
+Row 1: Co36
+Rows 2-3: [K P]18
+Rep Rows 2-3 until 5cm`
+
+	p, err := Parse("Meta", src)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := p.Meta
+
+	if m == nil || m.Title != "Seed stitch scarf" || m.Yarn != Worsted || len(m.Needles) != 2 ||
+		m.Needles[0] != 4.5 || m.Gauge == nil || m.Gauge.Rows != 24 || len(m.Measurements) != 2 ||
+		m.Measurements[1].Value != 150 {
+		t.Fatalf("Unexpected metadata %+v", m)
+	}
+
+	want := src[:strings.Index(src, "Row 1")] +
+		"Row1: Co36 \nRows2-3: [K P]18 \nRep Rows 2-3 until 5cm"
+
+	if have := p.String(); have != want {
+		t.Fatalf("String:\nWant: %q\nHave: %q", want, have)
+	}
+
+	if have := MustParse("Meta", want).String(); have != want {
+		t.Fatalf("Round trip:\nWant: %q\nHave: %q", want, have)
+	}
+
+	// The header gauge resolves the length: 5cm takes 12 rows.
+	counts, err := p.StitchCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(counts) != 13 {
+		t.Fatalf("Want 13 rows, have %d", len(counts))
+	}
+
+	if _, err = p.YarnUsage(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Parse("Invalid", "---\nTitle: A\nColour: red\n---\nRow 1: K")
+
+	if err == nil || !strings.HasPrefix(err.Error(), "Invalid:3:1 ") {
+		t.Fatalf("Expected unknown key error on line 3, have %v", err)
+	}
+
+	_, err = Parse("Invalid", "---\nTitle: A\n---\nRow 1: K $")
+
+	if err == nil || !strings.HasPrefix(err.Error(), "Invalid:4:") {
+		t.Fatalf("Expected syntax error on line 4, have %v", err)
+	}
+}
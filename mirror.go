@@ -0,0 +1,46 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+// Mirror returns a copy of the pattern for the mirror image piece.
+// This is what patterns describe as "work reversed", for example for
+// the second front of a cardigan.
+//
+// The stitch order of every row is reversed and all directional
+// stitches are replaced by their counterpart from StitchKind.Mirror.
+// All nodes retain their original source positions.
+func (p *Pattern) Mirror() *Pattern {
+	q := p.Copy()
+	recursive_mirror(q.Group)
+	return q
+}
+
+// recursive_mirror mirrors every row in the given group.
+func recursive_mirror(list *Group) {
+	var start int
+
+	nodes := list.Nodes()
+
+	for i, node := range nodes {
+		switch tt := node.(type) {
+		case *Row:
+			reverseNodes(nodes[start:i], mirrorStitch)
+			start = i + 1
+
+		case *Group:
+			if hasRows(tt) {
+				reverseNodes(nodes[start:i], mirrorStitch)
+				recursive_mirror(tt)
+				start = i + 1
+			}
+		}
+	}
+
+	reverseNodes(nodes[start:], mirrorStitch)
+}
+
+// mirrorStitch replaces the stitch kind with its mirror image.
+func mirrorStitch(st *Stitch) {
+	st.Kind = st.Kind.Mirror()
+}
@@ -0,0 +1,27 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "testing"
+
+func TestMirror(t *testing.T) {
+	p, err := Parse("Front", "Row 1: K3 Ssk [Lc P2] 2 Lli\nRow 2: P Ssp P4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Row1: Rli [P2 Rc]2 K2Tog K3 \nRow2: P4 P2Tog P"
+
+	if have := p.Mirror().String(); have != want {
+		t.Fatalf("Mirror: Want %q, have %q", want, have)
+	}
+
+	// A pass over stays behind the stitches it belongs to.
+	p = MustParse("Pass over", "Row 1: K Ks Dec Psso K2")
+	want = "Row1: K2 Ks Dec Psso K"
+
+	if have := p.Mirror().String(); have != want {
+		t.Fatalf("Mirror: Want %q, have %q", want, have)
+	}
+}
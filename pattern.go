@@ -12,8 +12,11 @@ import (
 
 // Pattern represents a single, complete knitting pattern.
 type Pattern struct {
-	*Group        // Root node for the pattern's node tree.
-	Name   string // Name of the pattern.
+	*Group              // Root node for the pattern's node tree.
+	Name    string      // Name of the pattern.
+	Meta    *Metadata   // Pattern header. Nil if the pattern has none.
+	Palette []*ColorDef // Colours declared by the pattern.
+	reg     *Registry   // Stitches the pattern was parsed with.
 }
 
 // MustParse parses the input pattern.
@@ -28,92 +31,418 @@ func MustParse(name, pat string) *Pattern {
 	return p
 }
 
-// Parse parses the given input pattern.
+// Parse parses the given input pattern, using the builtin stitches.
 func Parse(name, pat string) (*Pattern, error) {
+	return new(Parser).Parse(name, pat)
+}
+
+// A Parser parses patterns using its own registry of known stitches.
+// The zero value is ready for use and knows the builtin stitches only.
+type Parser struct {
+	Stitches *Registry // Known stitch kinds.
+}
+
+// NewParser creates a new parser with its own stitch registry, to which
+// custom stitches can be added.
+func NewParser() *Parser {
+	return &Parser{Stitches: NewRegistry()}
+}
+
+// MustParse parses the input pattern.
+// It panics if an error occurred.
+func (ps *Parser) MustParse(name, pat string) *Pattern {
+	p, err := ps.Parse(name, pat)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// Parse parses the given input pattern.
+func (ps *Parser) Parse(name, pat string) (*Pattern, error) {
 	var mod StitchMod
+	var color string
+	var colors []*token
+	var repeat *RepeatTo
+	var stage int
+	var repeating *token // Pending `Rep` keyword.
+	var repeatRow *Row   // Row read after the pending `Rep` keyword.
+	var rangeRow *Row    // Row awaiting the end of its range.
+	var row *Row         // Row currently being read.
+	var measure *RowRepeat
+
+	meta, pat, err := parseHeader(name, pat)
+
+	if err != nil {
+		return nil, err
+	}
 
 	p := new(Pattern)
 	p.Name = name
+	p.Meta = meta
 	p.Group = new(Group)
 	node := p.Group
-	tokens := lex(pat)
+	reg := ps.Stitches
+
+	if reg == nil {
+		reg = builtin
+	}
+
+	p.reg = reg
+	tokens := &lookahead{tokens: lex(pat, reg)}
 
 loop:
 	for {
-		select {
-		case tok := <-tokens:
-			if tok == nil || tok.Type == tokEof {
-				break loop
+		tok := tokens.next()
+
+		if tok == nil || tok.Type == tokEof {
+			break loop
+		}
+
+		// Keywords out of context are references.
+		if !inContext(tok, node, tokens, repeat != nil, repeatRow != nil, measure != nil) {
+			tok.Type = tokStitch
+		}
+
+		// A repeat up to a marker reads `to [N [sts] before] m|end`.
+		// The stage tracks how much of it has been read so far.
+		if repeat != nil && !continuesRepeat(tok.Type, stage) {
+			return nil, fmt.Errorf("%s:%d:%d Incomplete repeat %q, found %q,",
+				name, tok.Line, tok.Col, "to", tok.Data)
+		}
+
+		// A row repeat reads `Rep Row(s) N[-M] count`.
+		if repeating != nil && !continuesRowRepeat(tok.Type, repeatRow) {
+			return nil, fmt.Errorf("%s:%d:%d Incomplete row repeat, found %q,",
+				name, tok.Line, tok.Col, tok.Data)
+		}
+
+		// A measured row repeat continues with `until N unit`.
+		if measure != nil && !continuesMeasure(tok.Type, measure) {
+			return nil, fmt.Errorf("%s:%d:%d Incomplete row repeat, found %q,",
+				name, tok.Line, tok.Col, tok.Data)
+		}
+
+		if rangeRow != nil && tok.Type != tokNumber {
+			return nil, fmt.Errorf("%s:%d:%d Expected end of row range, found %q,",
+				name, tok.Line, tok.Col, tok.Data)
+		}
+
+		switch tok.Type {
+		case tokError:
+			return nil, fmt.Errorf("%s:%d:%d %s",
+				name, tok.Line, tok.Col, tok.Data)
+
+		case tokRepeat:
+			repeating = tok
+
+		case tokUntil:
+			if repeatRow == nil || repeatRow.Value == 0 {
+				return nil, fmt.Errorf("%s:%d:%d Expected row repeat before %q,",
+					name, tok.Line, tok.Col, tok.Data)
 			}
 
-			switch tok.Type {
-			case tokError:
-				return nil, fmt.Errorf("%s:%d:%d %s",
+			measure = newRowRepeat(repeating, repeatRow)
+			node.SetNode(node.Len()-1, measure)
+			repeating, repeatRow, row = nil, nil, nil
+
+		case tokUnit:
+			if measure == nil {
+				return nil, fmt.Errorf("%s:%d:%d Unexpected %q,",
 					name, tok.Line, tok.Col, tok.Data)
+			}
 
-			case tokGroupStart:
-				g := new(Group)
-				g.line = tok.Line
-				g.col = tok.Col
-				g.parent = node
-				node.Append(g)
-				node = g
-
-			case tokGroupEnd:
-				node = node.Parent()
-
-			case tokRow:
-				node.Append(&Row{tok.Line, tok.Col, 0})
-
-			case tokModifier:
-				mod |= getModKind(tok.Data)
-
-			case tokStitch:
-				st := getStitchKind(tok.Data)
-
-				if st == UnknownStitch {
-					// Consider this a reference to an external pattern.
-					node.Append(&Reference{tok.Data, tok.Line, tok.Col})
-				} else {
-					node.Append(&Stitch{
-						line: tok.Line,
-						col:  tok.Col,
-						Kind: st,
-						Mod:  mod,
-					})
-
-					mod = 0
-				}
+			measure.Unit = getUnit(tok.Data)
+			measure = nil
+
+		case tokRange:
+			row, ok := node.Node(node.Len() - 1).(*Row)
+
+			if !ok || row.Value == 0 || row.To > 0 || row.Side != UnknownSide {
+				return nil, fmt.Errorf("%s:%d:%d Expected Row number before %q,",
+					name, tok.Line, tok.Col, tok.Data)
+			}
+
+			rangeRow = row
+
+		case tokMarker:
+			node.Append(&Marker{
+				Op:   getMarkerOp(tok.Data),
+				line: tok.Line,
+				col:  tok.Col,
+			})
+
+		case tokTo:
+			switch node.Node(node.Len() - 1).(type) {
+			case *Stitch, *Group:
+			default:
+				return nil, fmt.Errorf("%s:%d:%d Expected Stitch or Group before %q,",
+					name, tok.Line, tok.Col, tok.Data)
+			}
+
+			repeat = &RepeatTo{line: tok.Line, col: tok.Col}
+			stage = 0
+			node.Append(repeat)
+
+		case tokBefore, tokSts:
+			if repeat == nil {
+				return nil, fmt.Errorf("%s:%d:%d Unexpected %q,",
+					name, tok.Line, tok.Col, tok.Data)
+			}
+
+			stage = repeatStage(tok.Type)
+
+		case tokTarget:
+			if repeat == nil {
+				return nil, fmt.Errorf("%s:%d:%d Unexpected %q,",
+					name, tok.Line, tok.Col, tok.Data)
+			}
+
+			repeat.End = strings.EqualFold(tok.Data, "end")
+			repeat = nil
 
-			case tokNumber:
-				if node.Len() == 0 {
-					return nil, fmt.Errorf(
-						"%s:%d:%d Expected Stitch, Group or Row, found Number %q,",
+		case tokParam:
+			if n, ok := getStitchCount(tok.Data); ok {
+				if row == nil || row.Count > 0 || n < 1 {
+					return nil, fmt.Errorf("%s:%d:%d Unexpected stitch count %q,",
 						name, tok.Line, tok.Col, tok.Data)
 				}
 
-				n, err := strconv.ParseInt(tok.Data, 10, 32)
+				row.Count = n
+				row.countLine, row.countCol = tok.Line, tok.Col
+				continue
+			}
 
-				if err != nil {
-					return nil, fmt.Errorf("%s:%d:%d Invalid number %q,",
-						name, tok.Line, tok.Col, tok.Data)
+			switch tt := node.Node(node.Len() - 1).(type) {
+			case *Marker:
+				if len(tt.Name) == 0 {
+					tt.Name = tok.Data
+					continue
 				}
 
-				switch tt := node.Node(node.Len() - 1).(type) {
-				case *Number:
-					// A number can not directly follow another number.
-					return nil, fmt.Errorf(
-						"%s:%d:%d Expected Stitch, Group or Row, found Number %q,",
+			case *RepeatTo:
+				if !tt.End && len(tt.Name) == 0 {
+					tt.Name = tok.Data
+					continue
+				}
+			}
+
+			return nil, fmt.Errorf("%s:%d:%d Unexpected parameter %q,",
+				name, tok.Line, tok.Col, tok.Data)
+
+		case tokGroupStart:
+			g := new(Group)
+			g.line = tok.Line
+			g.col = tok.Col
+			g.parent = node
+			node.Append(g)
+			node = g
+
+		case tokGroupEnd:
+			node = node.Parent()
+
+		case tokRow:
+			row = &Row{
+				Round: isRound(tok.Data),
+				line:  tok.Line,
+				col:   tok.Col,
+			}
+
+			if repeating != nil {
+				repeatRow = row
+			}
+
+			node.Append(row)
+
+		case tokSide:
+			row, ok := node.Node(node.Len() - 1).(*Row)
+
+			if !ok || row.Side != UnknownSide {
+				return nil, fmt.Errorf("%s:%d:%d Expected Row before %q,",
+					name, tok.Line, tok.Col, tok.Data)
+			}
+
+			row.Side = getSide(tok.Data)
+
+			if row.Round && row.Side == WrongSide {
+				return nil, fmt.Errorf("%s:%d:%d Rounds are always worked from the RS,",
+					name, tok.Line, tok.Col)
+			}
+
+		case tokTurn:
+			node.Append(&Turn{tok.Line, tok.Col})
+
+		case tokModifier:
+			mod |= getModKind(tok.Data)
+
+		case tokColor:
+			var value string
+
+			cname := tok.Data
+			def := strings.Index(cname, ":")
+
+			if def > -1 {
+				value = strings.TrimSpace(cname[def+1:])
+				cname = strings.TrimSpace(cname[:def])
+			}
+
+			if !isColorName(cname) || (def > -1 && (len(cname) == 0 || len(value) == 0)) {
+				return nil, fmt.Errorf("%s:%d:%d Invalid colour %q,",
+					name, tok.Line, tok.Col, tok.Data)
+			}
+
+			if def == -1 {
+				color = cname
+				colors = append(colors, tok)
+				break
+			}
+
+			if p.Color(cname) != nil {
+				return nil, fmt.Errorf("%s:%d:%d Duplicate colour %q,",
+					name, tok.Line, tok.Col, cname)
+			}
+
+			p.Palette = append(p.Palette, &ColorDef{cname, value, tok.Line, tok.Col})
+
+		case tokStitch:
+			def := reg.Lookup(tok.Data)
+
+			if def == nil {
+				// Consider this a reference to an external pattern.
+				node.Append(&Reference{tok.Data, tok.Line, tok.Col})
+				break
+			}
+
+			st := &Stitch{
+				line:  tok.Line,
+				col:   tok.Col,
+				Kind:  def.Kind,
+				Mod:   mod,
+				Color: color,
+			}
+
+			if def.Custom() {
+				st.Def = def
+			}
+
+			node.Append(st)
+			mod = 0
+
+		case tokNumber:
+			if node.Len() == 0 {
+				return nil, fmt.Errorf(
+					"%s:%d:%d Expected Stitch, Group or Row, found Number %q,",
+					name, tok.Line, tok.Col, tok.Data)
+			}
+
+			if measure != nil {
+				v, err := strconv.ParseFloat(tok.Data, 64)
+
+				if err != nil || v <= 0 {
+					return nil, fmt.Errorf("%s:%d:%d Invalid length %q,",
 						name, tok.Line, tok.Col, tok.Data)
+				}
+
+				measure.Until = v
+				break
+			}
 
-				case *Row:
-					// A number following a Row should be considered
-					// the row index instead of a quantifier.
-					tt.Value = int(n)
+			n, err := strconv.ParseInt(tok.Data, 10, 32)
 
-				default:
-					node.Append(&Number{int(n), tok.Line, tok.Col})
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d:%d Invalid number %q,",
+					name, tok.Line, tok.Col, tok.Data)
+			}
+
+			if repeat != nil {
+				repeat.Before = int(n)
+				stage = repeatStage(tok.Type)
+				break
+			}
+
+			if rangeRow != nil {
+				if int(n) <= rangeRow.Value {
+					return nil, fmt.Errorf("%s:%d:%d Invalid row range %d-%d,",
+						name, tok.Line, tok.Col, rangeRow.Value, n)
+				}
+
+				rangeRow.To = int(n)
+				rangeRow = nil
+				break
+			}
+
+			if repeatRow != nil && repeatRow.Value > 0 {
+				// The number following the rows to repeat is the
+				// repeat count. The Row node is replaced.
+				if n < 1 {
+					return nil, fmt.Errorf("%s:%d:%d Invalid row repeat count %d,",
+						name, tok.Line, tok.Col, n)
 				}
+
+				rr := newRowRepeat(repeating, repeatRow)
+				rr.Count = int(n)
+				node.SetNode(node.Len()-1, rr)
+
+				repeating, repeatRow, row = nil, nil, nil
+				break
+			}
+
+			switch tt := node.Node(node.Len() - 1).(type) {
+			case *Number:
+				// A number can not directly follow another number.
+				return nil, fmt.Errorf(
+					"%s:%d:%d Expected Stitch, Group or Row, found Number %q,",
+					name, tok.Line, tok.Col, tok.Data)
+
+			case *Row:
+				// A number following a Row should be considered
+				// the row index instead of a quantifier.
+				tt.Value = int(n)
+
+			case *Turn:
+				return nil, fmt.Errorf(
+					"%s:%d:%d A Turn can not be repeated, found Number %q,",
+					name, tok.Line, tok.Col, tok.Data)
+
+			case *Marker, *RepeatTo:
+				return nil, fmt.Errorf(
+					"%s:%d:%d Expected Stitch, Group or Row, found Number %q,",
+					name, tok.Line, tok.Col, tok.Data)
+
+			default:
+				node.Append(&Number{int(n), tok.Line, tok.Col})
+			}
+		}
+	}
+
+	if repeat != nil {
+		return nil, fmt.Errorf("%s:%d:%d Incomplete repeat %q,",
+			name, repeat.line, repeat.col, repeat)
+	}
+
+	if repeating != nil {
+		return nil, fmt.Errorf("%s:%d:%d Incomplete row repeat,",
+			name, repeating.Line, repeating.Col)
+	}
+
+	if measure != nil {
+		return nil, fmt.Errorf("%s:%d:%d Incomplete row repeat,",
+			name, measure.line, measure.col)
+	}
+
+	if rangeRow != nil {
+		return nil, fmt.Errorf("%s:%d:%d Incomplete row range,",
+			name, rangeRow.line, rangeRow.col)
+	}
+
+	// Once a palette is declared, every colour in use must be part of it.
+	if len(p.Palette) > 0 {
+		for _, tok := range colors {
+			if len(tok.Data) > 0 && p.Color(tok.Data) == nil {
+				return nil, fmt.Errorf("%s:%d:%d Undeclared colour %q,",
+					name, tok.Line, tok.Col, tok.Data)
 			}
 		}
 	}
@@ -137,11 +466,86 @@ func (p *Pattern) Expand(rh ReferenceHandler) error {
 	return nil
 }
 
+// Copy returns a deep copy of the pattern.
+func (p *Pattern) Copy() *Pattern {
+	q := &Pattern{
+		Group: recursive_copy(p.Group, nil),
+		Name:  p.Name,
+		reg:   p.reg,
+	}
+
+	if p.Meta != nil {
+		q.Meta = p.Meta.copy()
+	}
+
+	for _, c := range p.Palette {
+		cc := *c
+		q.Palette = append(q.Palette, &cc)
+	}
+
+	return q
+}
+
+// Unrolled returns an unrolled copy of the pattern, with all rows
+// materialised and repeats up to markers resolved. Lengths are resolved
+// with the gauge from the pattern header, if it has one. It returns an
+// error if the pattern holds unexpanded references. This is the form in
+// which stitch counts, charts and exports look at the pattern.
+func (p *Pattern) Unrolled() (*Pattern, error) {
+	var markers bool
+
+	q := p.Copy()
+
+	if q.Meta != nil && q.Meta.Gauge != nil {
+		if err := q.ResolveLengths(*q.Meta.Gauge); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := q.UnrollRows(); err != nil {
+		return nil, err
+	}
+
+	for _, node := range q.Nodes() {
+		switch tt := node.(type) {
+		case *Reference:
+			return nil, fmt.Errorf("%d:%d Unexpanded reference %q.",
+				tt.Line(), tt.Col(), tt.Name)
+		case *RepeatTo:
+			markers = true
+		}
+	}
+
+	if markers {
+		if err := q.ResolveMarkers(); err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
 // String returns a recreation of the original input pattern string.
 func (p *Pattern) String() string {
-	str := strings.TrimSpace(recursive_string(p.Group))
-	reg := regexp.MustCompile(`[ \t]+([0-9]+)`)
-	return reg.ReplaceAllString(str, "$1")
+	var color string
+
+	str := strings.TrimSpace(recursive_string(p.Group, &color))
+
+	if len(p.Palette) > 0 {
+		defs := make([]string, len(p.Palette))
+
+		for i, c := range p.Palette {
+			defs[i] = c.String()
+		}
+
+		str = strings.Join(defs, " ") + "\n" + str
+	}
+
+	if p.Meta != nil {
+		str = p.Meta.String() + "\n" + str
+	}
+
+	return str
 }
 
 // Unroll unrolls all 'loop' constructs.
@@ -176,6 +580,59 @@ func recursive_expand(list *Group, rh ReferenceHandler) error {
 	return nil
 }
 
+// recursive_copy recursively copies the given group and its children.
+func recursive_copy(list *Group, parent *Group) *Group {
+	g := new(Group)
+	g.line = list.line
+	g.col = list.col
+	g.parent = parent
+	g.nodes = make([]Node, len(list.nodes))
+
+	for i, node := range list.nodes {
+		if tt, ok := node.(*Group); ok {
+			g.nodes[i] = recursive_copy(tt, g)
+		} else {
+			g.nodes[i] = copyNode(node)
+		}
+	}
+
+	return g
+}
+
+// copyNode returns a copy of the given leaf node.
+func copyNode(node Node) Node {
+	switch tt := node.(type) {
+	case *Stitch:
+		n := *tt
+		return &n
+	case *Row:
+		n := *tt
+		return &n
+	case *Reference:
+		n := *tt
+		return &n
+	case *Number:
+		n := *tt
+		return &n
+	case *Turn:
+		n := *tt
+		return &n
+	case *Marker:
+		n := *tt
+		return &n
+	case *RowRepeat:
+		n := *tt
+		return &n
+	case *RepeatTo:
+		n := *tt
+		return &n
+	case *Group:
+		return recursive_copy(tt, tt.parent)
+	}
+
+	return node
+}
+
 // recursive_unroll recursively unwinds loops.
 func recursive_unroll(list *Group) {
 	var tmp []Node
@@ -200,16 +657,23 @@ func recursive_unroll(list *Group) {
 			copy(tmp, nodes[:i])
 			copy(tmp[i+tt.Value-1:], nodes[i+1:])
 
-			// Repeat the previous element num - 1 times.
+			// Repeat the previous element num - 1 times. Each repetition
+			// is a copy, so the nodes can be modified independently.
 			for k = 0; k < tt.Value-1; k++ {
-				tmp[i+k] = elem
+				tmp[i+k] = copyNode(elem)
+			}
+
+			// Record which repeat every stitch belongs to.
+			for k = 0; k < tt.Value && tt.Value > 1; k++ {
+				recursive_repeat(tmp[i-1+k], Repeat{elem, k + 1, tt.Value})
 			}
 
 			nodes = tmp
 		}
 	}
 
-	// Unpack groups.
+	// Unpack groups. A group repeated up to a marker can only be
+	// unrolled once the marker positions are known, so it is kept.
 	for i = 0; i < len(nodes); i++ {
 		tt, ok := nodes[i].(*Group)
 
@@ -217,6 +681,10 @@ func recursive_unroll(list *Group) {
 			continue
 		}
 
+		if _, ok = nodeAt(nodes, i+1).(*RepeatTo); ok {
+			continue
+		}
+
 		tmp = make([]Node, tt.Len()+len(nodes)-1)
 
 		copy(tmp, nodes[:i])
@@ -229,34 +697,95 @@ func recursive_unroll(list *Group) {
 	list.SetNodes(nodes)
 }
 
+// rowNumber matches the whitespace before a row number.
+var rowNumber = regexp.MustCompile(`[ \t]+([0-9]+)`)
+
+// recursive_repeat records the given repeat in all stitches of node.
+func recursive_repeat(node Node, r Repeat) {
+	switch tt := node.(type) {
+	case *Stitch:
+		tt.reps = append([]Repeat{r}, tt.reps...)
+	case *Group:
+		for _, n := range tt.Nodes() {
+			recursive_repeat(n, r)
+		}
+	}
+}
+
 // recursive_string recursively recreates the original input pattern string.
-func recursive_string(list *Group) string {
+// Colour changes are emitted wherever a stitch's colour differs from the
+// last one emitted, which is tracked in color.
+func recursive_string(list *Group, color *string) string {
 	var str []string
+	var row *Row
+
+	// A stated stitch count goes at the end of its row.
+	flush := func() {
+		if row != nil && row.Count > 0 {
+			str = append(str, row.CountString())
+		}
+
+		row = nil
+	}
 
 	nodes := list.Nodes()
 
 	for i := 0; i < len(nodes); i++ {
 		switch tt := nodes[i].(type) {
 		case *Group:
-			str = append(str, "["+recursive_string(tt)+"]")
+			str = append(str, "["+recursive_string(tt, color)+"]")
 
 		case *Reference:
 			str = append(str, tt.Name)
 
 		case *Stitch:
+			if tt.Color != *color {
+				str = append(str, "{"+tt.Color+"}")
+				*color = tt.Color
+			}
+
 			str = append(str, tt.String())
 
 		case *Row:
-			if tt.Value == 0 {
-				str = append(str, "\nRow:")
-			} else {
-				str = append(str, fmt.Sprintf("\nRow %d:", tt.Value))
-			}
+			flush()
+
+			// The row number is attached to the keyword. E.g.: `Row1:`.
+			str = append(str, "\n"+rowNumber.ReplaceAllString(tt.String(), "$1"))
+			row = tt
+
+		case *Turn:
+			str = append(str, "Turn")
+
+		case *Marker:
+			str = append(str, tt.String())
+
+		case *RowRepeat:
+			flush()
+			str = append(str, "\n"+tt.String())
+
+		case *RepeatTo:
+			str = append(str, tt.String())
 
 		case *Number:
-			str = append(str, fmt.Sprint(tt.Value))
+			// Quantifiers are attached to the element they follow,
+			// unless its name ends in a digit. E.g.: `K3`, but `Yo2 3`.
+			n := strconv.Itoa(tt.Value)
+
+			if len(str) == 0 {
+				str = append(str, n)
+				break
+			}
+
+			last := str[len(str)-1]
+
+			if isDigit(last[len(last)-1]) {
+				str[len(str)-1] = last + " " + n
+			} else {
+				str[len(str)-1] = last + n
+			}
 		}
 	}
 
+	flush()
 	return strings.Join(str, " ")
 }
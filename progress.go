@@ -0,0 +1,233 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// A Repeat describes one repetition of a group or stitch which encloses
+// a stitch in an unrolled pattern. E.g.: the third stitch in `[K2 P2] 6`
+// is worked in repeat 1 of 6 of the group, and repeat 1 of 2 of `P2`.
+//
+// Node belongs to the private copy of the pattern which was unrolled,
+// not to the pattern passed to NewProgress. Its contents may have been
+// changed by unrolling; only Line and Col are meaningful. They give the
+// position of the repeat in the source.
+type Repeat struct {
+	Node  Node // Repeated group or stitch. Only its position is meaningful.
+	Count int  // Number of the current repeat, starting at 1.
+	Total int  // Total number of repeats.
+}
+
+// A Position identifies a stitch in the unrolled pattern, by the index
+// of its row and the index of the stitch within the row. Both start at
+// 0. A row without stitches has a single position, with stitch index 0.
+// The position just past the last row marks the end of the pattern.
+//
+// Positions depend on the structure of the pattern only. They remain
+// valid when the pattern source is reformatted.
+type Position struct {
+	Row    int `json:"row"`
+	Stitch int `json:"stitch"`
+}
+
+// A Progress tracks a knitter's position in a pattern, stitch by stitch.
+// It walks the unrolled pattern, so row repeats and repeats up to markers
+// are followed as they are worked.
+//
+// A progress encodes to JSON as its position and a checksum of the
+// unrolled pattern. Decoding it into a progress created for a pattern
+// restores the position, provided the pattern has not been changed in
+// the meantime. Reformatting the pattern source does not count as a
+// change. For example:
+//
+//	pr, _ := knit.NewProgress(p)
+//	pr.Advance(10)
+//	data, _ := json.Marshal(pr)
+//
+//	pr, _ = knit.NewProgress(p)
+//	err := json.Unmarshal(data, pr)
+type Progress struct {
+	pattern  *Pattern    // Unrolled pattern.
+	rows     []*RowData  // Rows of the unrolled pattern.
+	stitches [][]*Stitch // Stitches of every row.
+	sum      string      // Checksum of the unrolled pattern.
+	pos      Position
+}
+
+// NewProgress creates a progress for the given pattern, positioned at
+// its first stitch.
+func NewProgress(p *Pattern) (*Progress, error) {
+	var color string
+
+	q, err := p.Unrolled()
+
+	if err != nil {
+		return nil, fmt.Errorf("Progress %q: %v", p.Name, err)
+	}
+
+	sum := sha1.Sum([]byte(recursive_string(q.Group, &color)))
+
+	pr := &Progress{
+		pattern: q,
+		rows:    q.Rows(),
+		sum:     hex.EncodeToString(sum[:]),
+	}
+
+	for _, row := range pr.rows {
+		var list []*Stitch
+
+		for _, node := range row.Nodes {
+			if st, ok := node.(*Stitch); ok {
+				list = append(list, st)
+			}
+		}
+
+		pr.stitches = append(pr.stitches, list)
+	}
+
+	return pr, nil
+}
+
+// Pattern returns the unrolled pattern walked by the progress. Row and
+// stitch indices in positions refer to it.
+func (pr *Progress) Pattern() *Pattern { return pr.pattern }
+
+// Pos returns the current position.
+func (pr *Progress) Pos() Position { return pr.pos }
+
+// Done returns true if all rows have been worked.
+func (pr *Progress) Done() bool { return pr.pos.Row >= len(pr.rows) }
+
+// Row returns the current row. Returns nil if all rows have been worked.
+func (pr *Progress) Row() *RowData {
+	if pr.Done() {
+		return nil
+	}
+
+	return pr.rows[pr.pos.Row]
+}
+
+// Stitches returns the stitches of the current row.
+func (pr *Progress) Stitches() []*Stitch {
+	if pr.Done() {
+		return nil
+	}
+
+	return pr.stitches[pr.pos.Row]
+}
+
+// Stitch returns the next stitch to work. Returns nil if the current row
+// has no stitches, or all rows have been worked.
+func (pr *Progress) Stitch() *Stitch {
+	list := pr.Stitches()
+
+	if pr.pos.Stitch >= len(list) {
+		return nil
+	}
+
+	return list[pr.pos.Stitch]
+}
+
+// Repeats returns the repeats enclosing the next stitch, outermost first.
+func (pr *Progress) Repeats() []Repeat {
+	st := pr.Stitch()
+
+	if st == nil {
+		return nil
+	}
+
+	return append([]Repeat(nil), st.reps...)
+}
+
+// Advance moves forward by n stitches. A row without stitches counts as
+// a single stitch. It stops at the end of the pattern.
+func (pr *Progress) Advance(n int) {
+	for ; n > 0 && !pr.Done(); n-- {
+		pr.pos.Stitch++
+
+		if pr.pos.Stitch >= len(pr.stitches[pr.pos.Row]) {
+			pr.pos = Position{pr.pos.Row + 1, 0}
+		}
+	}
+}
+
+// Retreat moves back by n stitches. It undoes Advance and stops at the
+// start of the pattern.
+func (pr *Progress) Retreat(n int) {
+	for ; n > 0 && (pr.pos.Row > 0 || pr.pos.Stitch > 0); n-- {
+		if pr.pos.Stitch > 0 {
+			pr.pos.Stitch--
+			continue
+		}
+
+		pr.pos.Row--
+		pr.pos.Stitch = 0
+
+		if k := len(pr.stitches[pr.pos.Row]); k > 0 {
+			pr.pos.Stitch = k - 1
+		}
+	}
+}
+
+// NextRow moves to the start of the next row.
+func (pr *Progress) NextRow() {
+	if !pr.Done() {
+		pr.pos = Position{pr.pos.Row + 1, 0}
+	}
+}
+
+// Seek moves to the given position. Returns an error if the position
+// lies outside the pattern.
+func (pr *Progress) Seek(pos Position) error {
+	valid := pos.Row >= 0 && pos.Row <= len(pr.rows) && pos.Stitch >= 0
+
+	if valid && pos.Stitch > 0 {
+		valid = pos.Row < len(pr.rows) && pos.Stitch < len(pr.stitches[pos.Row])
+	}
+
+	if !valid {
+		return fmt.Errorf("Progress %q: Row %d, stitch %d is not in the pattern.",
+			pr.pattern.Name, pos.Row+1, pos.Stitch+1)
+	}
+
+	pr.pos = pos
+	return nil
+}
+
+// jsonProgress is the JSON form of a progress.
+type jsonProgress struct {
+	Position
+	Sum string `json:"sum"`
+}
+
+// MarshalJSON encodes the position and the checksum of the pattern.
+func (pr *Progress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&jsonProgress{pr.pos, pr.sum})
+}
+
+// UnmarshalJSON restores a position encoded by MarshalJSON. The progress
+// must have been created with NewProgress. Returns an error if the
+// position was saved for a different pattern.
+func (pr *Progress) UnmarshalJSON(data []byte) error {
+	var jp jsonProgress
+
+	if pr.pattern == nil {
+		return fmt.Errorf("Progress is not bound to a pattern; create it with NewProgress.")
+	}
+
+	if err := json.Unmarshal(data, &jp); err != nil {
+		return err
+	}
+
+	if jp.Sum != pr.sum {
+		return fmt.Errorf("Progress %q: The saved position belongs to a different pattern.", pr.pattern.Name)
+	}
+
+	return pr.Seek(jp.Position)
+}
@@ -0,0 +1,88 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	src := "Row 1: Co4\nRow 2: [K1 P1] 2\nRow 3: K2 P to end"
+
+	pr, err := NewProgress(MustParse("Progress", src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr.Advance(6)
+
+	if pos, st := pr.Pos(), pr.Stitch(); pos != (Position{1, 2}) || st.Kind != KnitStitch {
+		t.Fatalf("Advance: Unexpected position %v at %v", pos, st)
+	}
+
+	reps := pr.Repeats()
+
+	if len(reps) != 1 || reps[0].Count != 2 || reps[0].Total != 2 ||
+		reps[0].Node.Line() != 2 || reps[0].Node.Col() != 8 {
+		t.Fatalf("Unexpected repeats %+v", reps)
+	}
+
+	// Repeats up to markers are resolved.
+	pr.Advance(5)
+
+	if reps := pr.Repeats(); pr.Pos() != (Position{2, 3}) || len(reps) != 1 ||
+		reps[0].Count != 2 || reps[0].Total != 2 || reps[0].Node.Col() != 11 {
+		t.Fatalf("Unexpected repeats %+v at %v", reps, pr.Pos())
+	}
+
+	pr.Retreat(4)
+
+	if pos := pr.Pos(); pos != (Position{1, 3}) {
+		t.Fatalf("Retreat: Unexpected position %v", pos)
+	}
+
+	data, err := json.Marshal(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reformatted pattern accepts the saved position.
+	pr, err = NewProgress(MustParse("Progress", "Row 1: Co4\n\nRow 2:\n  [K1 P1] 2\nRow 3: K1 K1 P to end"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(data, pr); err != nil {
+		t.Fatal(err)
+	}
+
+	if pos := pr.Pos(); pos != (Position{1, 3}) {
+		t.Fatalf("Restore: Unexpected position %v", pos)
+	}
+
+	pr.Advance(100)
+
+	if !pr.Done() || pr.Stitch() != nil || pr.Pos() != (Position{3, 0}) {
+		t.Fatalf("Expected the end of the pattern, have %v", pr.Pos())
+	}
+
+	if err := pr.Seek(Position{3, 1}); err == nil {
+		t.Fatalf("Expected error for a position past the end")
+	}
+
+	// A changed pattern does not.
+	pr, err = NewProgress(MustParse("Progress", "Row 1: Co4\nRow 2: [K1 P1] 2\nRow 3: K4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(data, pr); err == nil {
+		t.Fatalf("Expected error for a changed pattern")
+	}
+
+	if err := json.Unmarshal(data, new(Progress)); err == nil {
+		t.Fatalf("Expected error for an unbound progress")
+	}
+}
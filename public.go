@@ -0,0 +1,155 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+// PublicSide returns a copy of the pattern in which every wrong side
+// row is rewritten to show how it appears from the right side of the
+// work. This is what charts and fabric previews display.
+//
+// The stitch order of wrong side rows is reversed, every stitch kind is
+// replaced by its counterpart from StitchKind.Opposite and yarn forward
+// and backward modifiers are swapped. Row sides are resolved as described
+// for Pattern.Rows. Rows nested in repeated groups are resolved in the
+// order they appear in the pattern; unroll the pattern first if a group
+// holds an odd number of flat rows.
+//
+// All nodes retain their original source positions, so they can still
+// be traced back to the original pattern text. Row nodes keep their side
+// annotation, so the result is a view for display purposes, rather than
+// a pattern which can be knitted as-is.
+func (p *Pattern) PublicSide() *Pattern {
+	q := p.Copy()
+	side := WrongSide
+	recursive_public(q.Group, &side, false)
+	return q
+}
+
+// recursive_public rewrites all wrong side rows in the given group.
+// Side holds the side of the current row. It is updated whenever a
+// new Row node is encountered. Started is false until the first row
+// or stitch has been seen.
+func recursive_public(list *Group, side *Side, started bool) bool {
+	var start int
+
+	nodes := list.Nodes()
+
+	flush := func(end int) {
+		if *side == WrongSide {
+			reverseNodes(nodes[start:end], publicStitch)
+		}
+	}
+
+	for i, node := range nodes {
+		switch tt := node.(type) {
+		case *Row:
+			flush(i)
+			start = i + 1
+			started = true
+
+			switch {
+			case tt.Round:
+				*side = RightSide
+			case tt.Side != UnknownSide:
+				*side = tt.Side
+			default:
+				*side = side.Opposite()
+			}
+
+		case *Group:
+			if hasRows(tt) {
+				flush(i)
+				start = i + 1
+				started = recursive_public(tt, side, started)
+				break
+			}
+
+			if !started {
+				*side = RightSide
+				started = true
+			}
+
+		default:
+			if !started {
+				*side = RightSide
+				started = true
+			}
+		}
+	}
+
+	flush(len(nodes))
+	return started
+}
+
+// publicStitch rewrites a stitch from a wrong side row to its
+// right side appearance.
+func publicStitch(st *Stitch) {
+	st.Kind = st.Kind.Opposite()
+	st.Mod = st.Mod.Opposite()
+}
+
+// reverseNodes reverses the order in which the given nodes are worked,
+// in place. Quantifiers stay attached to the stitch or group they follow
+// and groups are reversed recursively. A pass over is kept together with
+// the two stitches before it, as it lifts the first of them over the
+// second. E.g.: `Ks K2Tog Psso` stays in this order. Likewise, a stitch
+// worked into the same stitch as the one before it stays behind it, as
+// in `K &@K`. A turn ending a short row stays at the end. The supplied
+// function is called for every stitch encountered.
+func reverseNodes(nodes []Node, fn func(*Stitch)) {
+	var units [][]Node
+
+	if n := len(nodes); n > 0 && isTurn(nodes[n-1]) {
+		nodes = nodes[:n-1]
+	}
+
+	for i := 0; i < len(nodes); i++ {
+		var pass, same bool
+
+		switch tt := nodes[i].(type) {
+		case *Stitch:
+			pass = tt.Kind == PassOver
+			same = tt.Mod&SameStitch != 0
+			fn(tt)
+		case *Group:
+			reverseNodes(tt.Nodes(), fn)
+		}
+
+		unit := []Node{nodes[i]}
+
+		if isRepeat(nodeAt(nodes, i+1)) {
+			unit = append(unit, nodes[i+1])
+			i++
+		}
+
+		if pass {
+			k := len(units) - 2
+
+			if k < 0 {
+				k = 0
+			}
+
+			var merged []Node
+
+			for _, prev := range units[k:] {
+				merged = append(merged, prev...)
+			}
+
+			unit = append(merged, unit...)
+			units = units[:k]
+		}
+
+		if same && len(units) > 0 {
+			units[len(units)-1] = append(units[len(units)-1], unit...)
+			continue
+		}
+
+		units = append(units, unit)
+	}
+
+	var n int
+
+	for i := len(units) - 1; i >= 0; i-- {
+		n += copy(nodes[n:], units[i])
+	}
+}
@@ -0,0 +1,54 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "testing"
+
+func TestPublicSide(t *testing.T) {
+	p, err := Parse("Public", "Row 1: K2 P3\nRow 2: K2 >P Ssk [Ssk Yo] 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Row1: K2 P3 \nRow2: [Yo Ssp]2 Ssp <K P2"
+	q := p.PublicSide()
+
+	if have := q.String(); have != want {
+		t.Fatalf("PublicSide: Want %q, have %q", want, have)
+	}
+
+	// The original is left untouched and positions are retained.
+	if have := p.String(); have != "Row1: K2 P3 \nRow2: K2 >P Ssk [Ssk Yo]2" {
+		t.Fatalf("PublicSide modified the original: %q", have)
+	}
+
+	st := q.Node(q.Len() - 2).(*Stitch)
+
+	if st.Line() != 2 || st.Col() != 8 {
+		t.Fatalf("PublicSide: Want position 2:8, have %d:%d", st.Line(), st.Col())
+	}
+
+	// A pass over stays behind the stitches it belongs to.
+	p = MustParse("Pass over", "Row 1: K5\nRow 2: P Ks Dec Psso P2")
+	want = "Row1: K5 \nRow2: K2 Ks Dec Psso K"
+
+	if have := p.PublicSide().String(); have != want {
+		t.Fatalf("PublicSide: Want %q, have %q", want, have)
+	}
+}
+
+func TestReverseSameStitch(t *testing.T) {
+	p := MustParse("Same stitch", "Row 1: K3\nRow 2: P K &@K")
+	want := "Row1: K3 \nRow2: P @&P K"
+
+	if have := p.PublicSide().String(); have != want {
+		t.Fatalf("PublicSide: Want %q, have %q", want, have)
+	}
+
+	want = "Row1: K3 \nRow2: K @&K P"
+
+	if have := p.Mirror().String(); have != want {
+		t.Fatalf("Mirror: Want %q, have %q", want, have)
+	}
+}
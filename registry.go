@@ -0,0 +1,267 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FirstCustomStitch is the first stitch kind assigned to custom stitches.
+// All builtin stitch kinds lie below it.
+const FirstCustomStitch StitchKind = 128
+
+// builtins lists the builtin stitch kinds, along with any aliases,
+// their human-readable names and chart symbols.
+var builtins = []struct {
+	kind    StitchKind
+	aliases []string
+	title   string
+	symbol  rune
+}{
+	{KnitStitch, nil, "Knit", '|'},
+	{PurlStitch, nil, "Purl", '-'},
+	{KnitSlip, nil, "Slip knitwise", 'v'},
+	{PurlSlip, nil, "Slip purlwise", 'V'},
+	{CastOn, nil, "Cast on", '+'},
+	{BindOff, nil, "Bind off", '#'},
+	{Increase, nil, "Increase", 'Y'},
+	{Decrease, []string{"tog"}, "Decrease", 'd'},
+	{YarnOver, nil, "Yarn over", 'o'},
+	{K2Tog, nil, "Knit two together", '/'},
+	{K3Tog, nil, "Knit three together", 'z'},
+	{K4Tog, nil, "Knit four together", 'Z'},
+	{P2Tog, nil, "Purl two together", ','},
+	{P3Tog, nil, "Purl three together", ';'},
+	{P4Tog, nil, "Purl four together", ':'},
+	{Cable, nil, "Cable", 'c'},
+	{PassOver, nil, "Pass slipped stitch over", '~'},
+	{SlipSlipKnit, nil, "Slip, slip, knit", '\\'},
+	{SlipSlipPurl, nil, "Slip, slip, purl", '`'},
+	{LeftCross, nil, "Left cross", '<'},
+	{RightCross, nil, "Right cross", '>'},
+	{LeftLiftedInc, nil, "Left lifted increase", 'l'},
+	{RightLiftedInc, nil, "Right lifted increase", 'r'},
+	{MakeOneLeft, []string{"m1"}, "Make one left", 'L'},
+	{MakeOneRight, nil, "Make one right", 'R'},
+	{KnitFrontBack, nil, "Knit front and back", 'k'},
+	{PurlFrontBack, nil, "Purl front and back", 'q'},
+	{S2kp, []string{"cdd"}, "Centred double decrease", 'A'},
+	{Sk2p, nil, "Slip, knit two together, pass over", 'N'},
+	{DoubleYarnOver, nil, "Double yarn over", 'O'},
+	{WrapTurn, nil, "Wrap and turn", 'w'},
+	{DoubleStitch, nil, "Double stitch", 'D'},
+}
+
+// builtin holds the builtin stitch kinds. It is used by parsers which
+// have no registry of their own and must never be modified.
+var builtin = NewRegistry()
+
+// StitchDef describes a single stitch kind.
+type StitchDef struct {
+	Kind     StitchKind // Stitch kind. Assigned by the registry for custom stitches.
+	Name     string     // Abbreviation used in patterns. E.g.: K2Tog or MB.
+	Title    string     // Human-readable name. E.g.: "Make bobble".
+	Consumes int        // Number of live stitches worked off the left needle.
+	Produces int        // Number of new stitches left on the right needle.
+	Symbol   rune       // Symbol representing the stitch in charts.
+
+	// Expand optionally holds the sequence of simpler stitches this
+	// stitch is made of, in pattern syntax. This turns the stitch into
+	// a macro. E.g.: `K Yo &K Yo &K` for a five stitch increase, worked
+	// into a single stitch. Refer to Pattern.Lower for details.
+	Expand string
+}
+
+// Custom returns true if this is a custom stitch kind.
+func (d *StitchDef) Custom() bool { return d.Kind >= FirstCustomStitch }
+
+// A Registry holds a set of known stitch kinds. Each parser can have
+// its own registry, which allows a host application to add its own
+// stitches, without affecting other parsers.
+type Registry struct {
+	names map[string]*StitchDef
+	kinds map[StitchKind]*StitchDef
+	next  StitchKind
+}
+
+// NewRegistry creates a new registry, holding all builtin stitch kinds.
+func NewRegistry() *Registry {
+	r := &Registry{
+		names: make(map[string]*StitchDef),
+		kinds: make(map[StitchKind]*StitchDef),
+		next:  FirstCustomStitch,
+	}
+
+	for _, b := range builtins {
+		def := &StitchDef{
+			Kind:     b.kind,
+			Name:     b.kind.String(),
+			Title:    b.title,
+			Consumes: b.kind.Consumes(),
+			Produces: b.kind.Produces(),
+			Symbol:   b.symbol,
+			Expand:   macros[b.kind],
+		}
+
+		r.kinds[def.Kind] = def
+		r.names[strings.ToLower(def.Name)] = def
+
+		for _, alias := range b.aliases {
+			r.names[alias] = def
+		}
+	}
+
+	return r
+}
+
+// Lookup returns the definition for the given stitch name.
+// The lookup is case insensitive. Returns nil if the name is unknown.
+func (r *Registry) Lookup(name string) *StitchDef {
+	return r.names[strings.ToLower(name)]
+}
+
+// Def returns the definition for the given stitch kind.
+// Returns nil if the kind is unknown.
+func (r *Registry) Def(k StitchKind) *StitchDef {
+	return r.kinds[k]
+}
+
+// Defs returns all known stitch definitions, ordered by kind.
+func (r *Registry) Defs() []*StitchDef {
+	list := make([]*StitchDef, 0, len(r.kinds))
+
+	for _, def := range r.kinds {
+		list = append(list, def)
+	}
+
+	sort.Sort(defsByKind(list))
+	return list
+}
+
+// Register adds a custom stitch kind to the registry. The registry
+// assigns it a new StitchKind and returns the stored definition.
+//
+// The name must start with a letter and consist of letters, digits and
+// `&`. It must not already be in use. If an expansion is given, it must
+// consist of known stitches only and work the same number of stitches
+// as the definition states.
+func (r *Registry) Register(def StitchDef) (*StitchDef, error) {
+	if err := r.checkName(def.Name); err != nil {
+		return nil, err
+	}
+
+	if def.Consumes < 0 || def.Produces < 0 {
+		return nil, fmt.Errorf("Register %q: Invalid stitch counts %d/%d.",
+			def.Name, def.Consumes, def.Produces)
+	}
+
+	if r.next < FirstCustomStitch {
+		return nil, fmt.Errorf("Register %q: Too many custom stitches.", def.Name)
+	}
+
+	if len(def.Expand) > 0 {
+		if err := r.checkExpansion(&def); err != nil {
+			return nil, err
+		}
+	}
+
+	d := def
+	d.Kind = r.next
+	r.next++
+
+	r.kinds[d.Kind] = &d
+	r.names[strings.ToLower(d.Name)] = &d
+	return &d, nil
+}
+
+// Alias adds an alternative name for an existing stitch.
+func (r *Registry) Alias(alias, name string) error {
+	def := r.Lookup(name)
+
+	if def == nil {
+		return fmt.Errorf("Alias %q: Unknown stitch %q.", alias, name)
+	}
+
+	if err := r.checkName(alias); err != nil {
+		return err
+	}
+
+	r.names[strings.ToLower(alias)] = def
+	return nil
+}
+
+// checkName returns an error if the given name can not be used
+// for a new stitch or alias.
+func (r *Registry) checkName(name string) error {
+	if len(name) == 0 || !isLetter(name[0]) {
+		return fmt.Errorf("Register %q: Invalid stitch name.", name)
+	}
+
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i]) {
+			return fmt.Errorf("Register %q: Invalid stitch name.", name)
+		}
+	}
+
+	if _, ok := keywords[strings.ToLower(name)]; ok {
+		return fmt.Errorf("Register %q: Name is a reserved keyword.", name)
+	}
+
+	if r.Lookup(name) != nil {
+		return fmt.Errorf("Register %q: Name is already in use.", name)
+	}
+
+	return nil
+}
+
+// checkExpansion returns an error if the expansion of the given stitch
+// is not a valid sequence of known stitches, or if it does not consume
+// and produce the same number of stitches as the stitch itself.
+func (r *Registry) checkExpansion(def *StitchDef) error {
+	p, err := (&Parser{Stitches: r}).Parse(def.Name, def.Expand)
+
+	if err != nil {
+		return fmt.Errorf("Register %q: %v", def.Name, err)
+	}
+
+	if err = recursive_check_expansion(def.Name, p.Group); err != nil {
+		return err
+	}
+
+	consumes, produces := sequenceCounts(p.Nodes())
+
+	if consumes != def.Consumes || produces != def.Produces {
+		return fmt.Errorf("Register %q: Expansion %q works %d/%d stitches, expected %d/%d.",
+			def.Name, def.Expand, consumes, produces, def.Consumes, def.Produces)
+	}
+
+	return nil
+}
+
+// recursive_check_expansion ensures the given group holds nothing but
+// stitches, quantifiers and nested groups.
+func recursive_check_expansion(name string, list *Group) error {
+	for _, node := range list.Nodes() {
+		switch tt := node.(type) {
+		case *Stitch, *Number:
+		case *Group:
+			if err := recursive_check_expansion(name, tt); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Register %q: %d:%d Expansion must consist of stitches only, found %T.",
+				name, node.Line(), node.Col(), node)
+		}
+	}
+
+	return nil
+}
+
+type defsByKind []*StitchDef
+
+func (d defsByKind) Len() int           { return len(d) }
+func (d defsByKind) Less(i, j int) bool { return d[i].Kind < d[j].Kind }
+func (d defsByKind) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
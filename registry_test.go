@@ -0,0 +1,52 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	ps := NewParser()
+
+	def, err := ps.Stitches.Register(StitchDef{
+		Name:     "Tw2",
+		Title:    "Twisted knit two",
+		Consumes: 2,
+		Produces: 2,
+		Symbol:   '*',
+		Expand:   "@K2",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ps.Stitches.Register(StitchDef{Name: "k2tog"}); err == nil {
+		t.Fatal("Expected error for duplicate stitch name")
+	}
+
+	p, err := ps.Parse("Custom", "K2 tw2 3 K2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, ok := p.Node(2).(*Stitch)
+
+	if !ok || st.Kind != def.Kind || st.Def != def {
+		t.Fatalf("Custom stitch: Want %s, have %T %v", def.Name, p.Node(2), p.Node(2))
+	}
+
+	if have := p.String(); have != "K2 Tw2 3 K2" {
+		t.Fatalf("String: Want %q, have %q", "K2 Tw2 3 K2", have)
+	}
+
+	// Other parsers are not affected by the registration.
+	q, err := Parse("Builtin", "K2 tw2 K2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := q.Node(2).(*Stitch); ok {
+		t.Fatal("Custom stitch leaked into the builtin registry")
+	}
+}
@@ -0,0 +1,356 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// A Rounding describes a quantity which could not be scaled exactly
+// while regrading a pattern, along with the value it was rounded to.
+type Rounding struct {
+	Line  int     // Source line of the Number node which was scaled.
+	Col   int     // Source column of the Number node which was scaled.
+	What  string  // What the quantity counts. E.g.: "cast-on" or "motif repeat".
+	Old   int     // Original quantity.
+	Exact float64 // Exact scaled quantity.
+	New   int     // Quantity after rounding.
+	Note  string  // Optional explanation of how the value was rounded.
+}
+
+func (r *Rounding) String() string {
+	s := fmt.Sprintf("%d:%d %s: %d scales to %.2f, rounded to %d",
+		r.Line, r.Col, r.What, r.Old, r.Exact, r.New)
+
+	if len(r.Note) > 0 {
+		s += " (" + r.Note + ")"
+	}
+
+	return s
+}
+
+// Regrade rescales the pattern, written for gauge from, so that it yields
+// the same dimensions when knitted at gauge to.
+//
+// It returns a list of all quantities which could not be scaled exactly.
+// Refer to Pattern.Scale for details on what is scaled and how. A gauge
+// declared in the pattern header is updated to the new gauge.
+func (p *Pattern) Regrade(from, to Gauge) ([]*Rounding, error) {
+	if err := from.Validate(); err != nil {
+		return nil, fmt.Errorf("Regrade %q: %v", p.Name, err)
+	}
+
+	if err := to.Validate(); err != nil {
+		return nil, fmt.Errorf("Regrade %q: %v", p.Name, err)
+	}
+
+	if p.Meta != nil && p.Meta.Gauge != nil {
+		p.Meta.Gauge = &to
+	}
+
+	sx := to.StitchesPer(Centimeter) / from.StitchesPer(Centimeter)
+	sy := to.RowsPer(Centimeter) / from.RowsPer(Centimeter)
+	return p.Scale(sx, sy), nil
+}
+
+// RegradeWidth rescales the pattern, knitted at gauge g, so that its
+// cast-on edge measures the given width.
+//
+// Only horizontal quantities are affected. Refer to Pattern.Scale for
+// details on what is scaled and how.
+func (p *Pattern) RegradeWidth(g Gauge, width float64, u Unit) ([]*Rounding, error) {
+	if err := g.Validate(); err != nil {
+		return nil, fmt.Errorf("Regrade %q: %v", p.Name, err)
+	}
+
+	if width <= 0 {
+		return nil, fmt.Errorf("Regrade %q: Invalid width %g%s.", p.Name, width, u)
+	}
+
+	co := castOnCount(p.Nodes())
+
+	if co == 0 {
+		return nil, fmt.Errorf("Regrade %q: Pattern has no cast-on stitches.", p.Name)
+	}
+
+	current := float64(co) / g.StitchesPer(u)
+	return p.Scale(width/current, 1), nil
+}
+
+// Scale scales the pattern's horizontal quantities by factor sx and its
+// vertical quantities by factor sy. It returns a list of all quantities
+// which could not be scaled exactly.
+//
+// Only repeat counts at row level are affected. Stitches and repeats nested
+// inside a motif group define the motif itself and are left untouched,
+// so the pattern's stitch multiple remains intact:
+//
+//   - The repeat count of a group holding Row nodes is a row count and is
+//     scaled by sy. Rows inside such a group are scaled recursively.
+//   - The repeat count of any other group is a motif repeat and is scaled by sx.
+//   - Cast-on counts are scaled by sx and rounded to the nearest value which
+//     still fits the motif stitch multiple. E.g.: a multiple of 4 plus 2.
+//   - Other stitch repeats are scaled by sx, unless the row holds a repeated
+//     motif. In that case they are considered border stitches and are kept.
+//   - The count of a row repeat like `Rep Rows 3-4 2` is scaled by sy.
+//     Row ranges like `Rows 3-10` are left alone: they number rows, rather
+//     than count them. Scaling them would renumber all rows after them.
+//     Repeats up to a length, like `Rep Rows 3-4 until 20cm`, are kept.
+//
+// Scaled quantities never drop below 1. Stitch counts stated by rows are
+// left as they are; Pattern.Validate reports those which no longer hold.
+func (p *Pattern) Scale(sx, sy float64) []*Rounding {
+	var out []*Rounding
+
+	nodes := p.Nodes()
+	multiple := motifMultiple(nodes)
+
+	recursive_scale(nodes, sx, sy, multiple, &out)
+	return out
+}
+
+// recursive_scale splits the given node list into rows and scales
+// each of them.
+func recursive_scale(nodes []Node, sx, sy float64, multiple int, out *[]*Rounding) {
+	var start int
+
+	for i, node := range nodes {
+		if _, ok := node.(*Row); ok {
+			scaleRow(nodes[start:i], sx, sy, multiple, out)
+			start = i
+		}
+	}
+
+	scaleRow(nodes[start:], sx, sy, multiple, out)
+}
+
+// scaleRow scales the quantities for a single row of nodes.
+func scaleRow(nodes []Node, sx, sy float64, multiple int, out *[]*Rounding) {
+	var motif bool
+
+	for i := 1; i < len(nodes); i++ {
+		if _, ok := nodes[i].(*Number); !ok {
+			continue
+		}
+
+		if g, ok := nodes[i-1].(*Group); ok && !hasRows(g) {
+			motif = true
+			break
+		}
+	}
+
+	for i, node := range nodes {
+		if rr, ok := node.(*RowRepeat); ok {
+			if rr.Until > 0 {
+				continue
+			}
+
+			num := &Number{rr.Count, rr.line, rr.col}
+			scaleNumber(num, sy, 1, 0, "row repeat", out)
+			rr.Count = num.Value
+			continue
+		}
+
+		num, ok := node.(*Number)
+
+		if !ok || i == 0 {
+			if g, ok := node.(*Group); ok && hasRows(g) {
+				recursive_scale(g.Nodes(), sx, sy, multiple, out)
+			}
+			continue
+		}
+
+		switch tt := nodes[i-1].(type) {
+		case *Group:
+			if hasRows(tt) {
+				scaleNumber(num, sy, 1, 0, "row repeat", out)
+			} else {
+				scaleNumber(num, sx, 1, 0, "motif repeat", out)
+			}
+
+		case *Stitch:
+			if tt.Kind == CastOn {
+				scaleNumber(num, sx, multiple, num.Value%multiple, "cast-on", out)
+			} else if !motif {
+				scaleNumber(num, sx, 1, 0, "stitch repeat", out)
+			}
+		}
+	}
+}
+
+// scaleNumber scales the value of n by factor f. The result is rounded to
+// the nearest value which is a multiple of step, plus the given offset.
+// A result below 1 is raised to the smallest such value of at least 1.
+// A Rounding is added to out if the result is not exact.
+func scaleNumber(n *Number, f float64, step, offset int, what string, out *[]*Rounding) {
+	var notes []string
+
+	exact := float64(n.Value) * f
+	count := math.Floor(float64(n.Value-offset)*f/float64(step) + 0.5)
+
+	if count < 0 {
+		count = 0
+	}
+
+	r := &Rounding{
+		Line:  n.line,
+		Col:   n.col,
+		What:  what,
+		Old:   n.Value,
+		Exact: exact,
+		New:   int(count)*step + offset,
+	}
+
+	// The offset is smaller than the step, so this only happens for an
+	// offset of 0. The smallest fitting value is then the step itself.
+	clamped := r.New < 1
+
+	if clamped {
+		r.New = step
+	}
+
+	n.Value = r.New
+
+	if math.Abs(exact-float64(r.New)) < 1e-9 {
+		return
+	}
+
+	if step > 1 {
+		notes = append(notes, fmt.Sprintf("multiple of %d plus %d", step, offset))
+	}
+
+	if clamped {
+		notes = append(notes, fmt.Sprintf("raised to the minimum of %d", r.New))
+	}
+
+	r.Note = strings.Join(notes, ", ")
+	*out = append(*out, r)
+}
+
+// motifMultiple returns the least common multiple of the stitch widths
+// of all repeated motif groups at row level. It yields 1 if there are
+// no such groups.
+func motifMultiple(nodes []Node) int {
+	m := 1
+
+	for i := 1; i < len(nodes); i++ {
+		g, ok := nodes[i-1].(*Group)
+
+		if !ok {
+			continue
+		}
+
+		if hasRows(g) {
+			if n := motifMultiple(g.Nodes()); n > 1 {
+				m = lcm(m, n)
+			}
+			continue
+		}
+
+		if _, ok := nodes[i].(*Number); !ok {
+			continue
+		}
+
+		if n := stitchWidth(g.Nodes()); n > 0 {
+			m = lcm(m, n)
+		}
+	}
+
+	return m
+}
+
+// stitchWidth returns the number of stitches worked by a single pass
+// over the given nodes. It returns 0 if the width can not be determined,
+// because the list holds unexpanded references.
+func stitchWidth(nodes []Node) int {
+	var width, last int
+
+	for _, node := range nodes {
+		switch tt := node.(type) {
+		case *Stitch:
+			last = tt.Consumes()
+
+			if n := tt.Produces(); n > last {
+				last = n
+			}
+
+		case *Group:
+			last = stitchWidth(tt.Nodes())
+
+			if last == 0 {
+				return 0
+			}
+
+		case *Number:
+			width += last * (tt.Value - 1)
+			continue
+
+		case *Reference:
+			return 0
+
+		default:
+			last = 0
+		}
+
+		width += last
+	}
+
+	return width
+}
+
+// castOnCount returns the number of cast-on stitches at row level.
+func castOnCount(nodes []Node) int {
+	var count int
+
+	for i, node := range nodes {
+		st, ok := node.(*Stitch)
+
+		if !ok || st.Kind != CastOn {
+			continue
+		}
+
+		if num, ok := nodeAt(nodes, i+1).(*Number); ok {
+			count += num.Value
+		} else {
+			count++
+		}
+	}
+
+	return count
+}
+
+// hasRows returns true if the given group holds any Row nodes.
+func hasRows(g *Group) bool {
+	for _, node := range g.Nodes() {
+		switch tt := node.(type) {
+		case *Row:
+			return true
+		case *Group:
+			if hasRows(tt) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// nodeAt returns the node at index i, or nil if i is out of range.
+func nodeAt(nodes []Node, i int) Node {
+	if i < 0 || i >= len(nodes) {
+		return nil
+	}
+	return nodes[i]
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a, b int) int { return a / gcd(a, b) * b }
@@ -0,0 +1,48 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "testing"
+
+func TestRegrade(t *testing.T) {
+	p, err := Parse("Rib", "Row 1: Co 42\n[Row K2 [P2 K2] 10 Row P2 [K2 P2] 10] 20")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := Gauge{Stitches: 20, Rows: 28}
+	to := Gauge{Stitches: 24, Rows: 35}
+
+	list, err := p.Regrade(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Row1: Co50 [\nRow: K2 [P2 K2]12 \nRow: P2 [K2 P2]12]25"
+
+	if have := p.String(); have != want {
+		t.Fatalf("Regrade: Want %q, have %q", want, have)
+	}
+
+	// 42 * 1.2 = 50.4 for the cast-on; the motif and row repeats are exact.
+	if len(list) != 1 || list[0].What != "cast-on" || list[0].New != 50 {
+		t.Fatalf("Regrade: unexpected roundings: %v", list)
+	}
+
+	// Scaling down never yields more stitches than the original. Values
+	// below 1 are raised to the smallest value which fits.
+	p = MustParse("Small", "Row 1: Co6\nRow 2: K2 [P2 K2] 1\nRow 3: Co8")
+	list = p.Scale(0.1, 1)
+	want = "Row1: Co2 \nRow2: K2 [P2 K2]1 \nRow3: Co4"
+
+	if have := p.String(); have != want {
+		t.Fatalf("Scale down: Want %q, have %q", want, have)
+	}
+
+	if len(list) != 3 || list[0].Note != "multiple of 4 plus 2" ||
+		list[1].Note != "raised to the minimum of 1" ||
+		list[2].Note != "multiple of 4 plus 0, raised to the minimum of 4" {
+		t.Fatalf("Scale down: unexpected roundings: %v", list)
+	}
+}
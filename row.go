@@ -3,13 +3,109 @@
 
 package knit
 
+import (
+	"strconv"
+	"strings"
+)
+
+// Side denotes the side of the work facing the knitter.
+type Side uint8
+
+// Known sides.
+const (
+	UnknownSide Side = iota
+	RightSide        // Public side of the fabric.
+	WrongSide        // Private side of the fabric.
+)
+
+// String returns the customary abbreviation for the given side.
+func (s Side) String() string {
+	switch s {
+	case UnknownSide:
+		return ""
+	case RightSide:
+		return "RS"
+	case WrongSide:
+		return "WS"
+	}
+
+	panic("unreachable")
+}
+
+// Opposite returns the other side of the work.
+func (s Side) Opposite() Side {
+	switch s {
+	case RightSide:
+		return WrongSide
+	case WrongSide:
+		return RightSide
+	}
+
+	return UnknownSide
+}
+
+// isRound returns true if the given row keyword denotes a round.
+func isRound(v string) bool {
+	return !strings.HasPrefix(strings.ToLower(v), "row")
+}
+
+// getSide returns the side represented by the given string.
+func getSide(v string) Side {
+	switch strings.ToLower(v) {
+	case "rs":
+		return RightSide
+	case "ws":
+		return WrongSide
+	}
+
+	return UnknownSide
+}
+
+// Direction denotes the direction in which a row is worked,
+// as seen from the right side of the work.
+type Direction uint8
+
+// Known directions.
+const (
+	RightToLeft Direction = iota
+	LeftToRight
+)
+
+// String returns a human-readable form of the direction.
+func (d Direction) String() string {
+	switch d {
+	case RightToLeft:
+		return "right-to-left"
+	case LeftToRight:
+		return "left-to-right"
+	}
+
+	panic("unreachable")
+}
+
 // A row node determines that the following pattern nodes
 // belong to a given row. The row can optionally have a number
 // defined for it.
+//
+// A row can be a flat row, worked back and forth, or a round,
+// worked in circles. Flat rows can be annotated with the side
+// of the work facing the knitter.
+//
+// A row can also denote a range of rows, which are all worked
+// the same. E.g.: `Rows 3-10: K2 P2`.
+//
+// A row can state the number of live stitches it ends with, as a check
+// for the knitter. E.g.: `Row 4: K2Tog K to end (47 sts)`.
 type Row struct {
-	Value int
-	line  int
-	col   int
+	Value     int
+	To        int  // Last row of a range; 0 for a single row.
+	Round     bool // Is this a round instead of a flat row?
+	Side      Side // Explicit side annotation; UnknownSide if absent.
+	Count     int  // Stated stitch count after the row; 0 if absent.
+	line      int
+	col       int
+	countLine int // Source position of the stitch count.
+	countCol  int
 }
 
 // Line returns the original pattern source line number for this node.
@@ -17,3 +113,67 @@ func (r *Row) Line() int { return r.line }
 
 // Col returns the original pattern source column number for this node.
 func (r *Row) Col() int { return r.col }
+
+// CountPos returns the original pattern source position of the
+// stated stitch count. This is the row's own position if the count
+// has no source of its own.
+func (r *Row) CountPos() (int, int) {
+	if r.countLine == 0 {
+		return r.line, r.col
+	}
+
+	return r.countLine, r.countCol
+}
+
+// String returns the row header. The stated stitch count is written
+// at the end of the row; see Row.CountString.
+func (r *Row) String() string {
+	s := "Row"
+
+	if r.Round {
+		s = "Rnd"
+	}
+
+	if r.To > r.Value {
+		s = s + "s " + strconv.Itoa(r.Value) + "-" + strconv.Itoa(r.To)
+	} else if r.Value > 0 {
+		s = s + " " + strconv.Itoa(r.Value)
+	}
+
+	if r.Side != UnknownSide {
+		s = s + " " + r.Side.String()
+	}
+
+	return s + ":"
+}
+
+// CountString returns the stated stitch count, as written at the end of
+// the row. E.g.: `(48 sts)`. Returns an empty string if there is none.
+func (r *Row) CountString() string {
+	switch r.Count {
+	case 0:
+		return ""
+	case 1:
+		return "(1 st)"
+	}
+
+	return "(" + strconv.Itoa(r.Count) + " sts)"
+}
+
+// getStitchCount parses the contents of a stitch count parameter.
+// E.g.: `48 sts` or `1 st`. Returns false if v is not a stitch count.
+func getStitchCount(v string) (int, bool) {
+	f := strings.Fields(strings.ToLower(v))
+
+	if len(f) != 2 || !isStitchCount(f[1]) {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(f[0])
+	return n, err == nil
+}
+
+// isStitchCount returns true if v names a count of stitches.
+func isStitchCount(v string) bool {
+	return v == "st" || v == "sts" || v == "stitch" || v == "stitches"
+}
@@ -0,0 +1,50 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "testing"
+
+func TestRowSides(t *testing.T) {
+	p, err := Parse("Sides", "Row 1: K5 Row 2: P5 Row 3 WS: K5 Row 4: K5 Rnd 5: K5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sides := []Side{RightSide, WrongSide, WrongSide, RightSide, RightSide}
+	rows := p.Rows()
+
+	if len(rows) != len(sides) {
+		t.Fatalf("Rows: Want %d, have %d", len(sides), len(rows))
+	}
+
+	for i, row := range rows {
+		if row.Side != sides[i] {
+			t.Fatalf("Row %d: Want side %s, have %s", i+1, sides[i], row.Side)
+		}
+	}
+
+	if rows[2].Direction() != LeftToRight || rows[2].Public(KnitStitch) != PurlStitch {
+		t.Fatalf("Row 3: Expected WS knit to show as RS purl, worked left-to-right")
+	}
+
+	if !rows[4].Round {
+		t.Fatalf("Row 5: Expected a round")
+	}
+
+	if _, err := Parse("Invalid", "Rnd 1 WS: K5"); err == nil {
+		t.Fatal("Expected error for WS round")
+	}
+
+	// Anywhere but after a row header, RS and WS are references.
+	p, err = Parse("References", "Row 1: K2 WS 2 Rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []int{3, 5} {
+		if _, ok := p.Node(i).(*Reference); !ok {
+			t.Fatalf("Node %d: Want a reference, have %T", i, p.Node(i))
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// A RowRepeat node repeats a block of previously defined rows a number
+// of more times. E.g.: `Rep Rows 1-4 6` works rows 1 to 4 six more times.
+// Refer to Pattern.UnrollRows for details.
+//
+// Instead of a fixed count, the block can be repeated until the piece
+// measures a given length from the cast-on edge. E.g.: `Rep Rows 1-4
+// until 30cm`. Refer to Pattern.ResolveLengths for details.
+type RowRepeat struct {
+	From  int     // First row of the block.
+	To    int     // Last row of the block. Equals From for a single row.
+	Count int     // Number of additional times the block is worked.
+	Until float64 // Length the piece must reach; 0 for a fixed count.
+	Unit  Unit    // Unit in which Until is expressed.
+	Round bool    // Does the block consist of rounds?
+	line  int
+	col   int
+}
+
+// newRowRepeat creates a row repeat for the given `Rep` keyword token
+// and the rows following it.
+func newRowRepeat(tok *token, row *Row) *RowRepeat {
+	rr := &RowRepeat{
+		From:  row.Value,
+		To:    row.To,
+		Round: row.Round,
+		line:  tok.Line,
+		col:   tok.Col,
+	}
+
+	if rr.To == 0 {
+		rr.To = rr.From
+	}
+
+	return rr
+}
+
+// Line returns the original pattern source line number for this node.
+func (r *RowRepeat) Line() int { return r.line }
+
+// Col returns the original pattern source column number for this node.
+func (r *RowRepeat) Col() int { return r.col }
+
+func (r *RowRepeat) String() string {
+	s := "Rep Row"
+
+	if r.Round {
+		s = "Rep Rnd"
+	}
+
+	if r.To > r.From {
+		s = s + "s " + strconv.Itoa(r.From) + "-" + strconv.Itoa(r.To)
+	} else {
+		s = s + " " + strconv.Itoa(r.From)
+	}
+
+	if r.Until > 0 {
+		return s + " until " + formatLength(r.Until, r.Unit)
+	}
+
+	return s + " " + strconv.Itoa(r.Count)
+}
+
+// continuesRowRepeat returns true if a token of the given type can follow
+// the `Rep` keyword, given the Row read after it so far, if any.
+func continuesRowRepeat(tt tokenType, row *Row) bool {
+	if row == nil {
+		return tt == tokRow
+	}
+
+	return tt == tokNumber || tt == tokUntil || (tt == tokRange && row.To == 0)
+}
+
+// continuesMeasure returns true if a token of the given type can follow
+// the `until` keyword of the given row repeat.
+func continuesMeasure(tt tokenType, rr *RowRepeat) bool {
+	if rr.Until == 0 {
+		return tt == tokNumber
+	}
+
+	return tt == tokUnit
+}
+
+// UnrollRows unrolls the pattern and materialises every row it describes,
+// so that each row is listed explicitly, with its own Row node.
+//
+// A row range like `Rows 3-10: K2 P2` becomes the rows 3 to 10, each
+// holding a copy of the range's stitches. Only the first of them keeps an
+// explicit side annotation; the others alternate sides as usual.
+//
+// A row repeat like `Rep Rows 1-4 6` is replaced by six more copies of
+// the rows 1 to 4, as they were last defined. The copies are numbered
+// consecutively, after the highest row number seen so far. They keep the
+// side annotations of the rows they copy.
+//
+// Rows without a number are kept as they are. They can not be repeated.
+func (p *Pattern) UnrollRows() error {
+	var nodes []Node
+	var last int
+
+	defined := make(map[int]*RowData)
+
+	p.Unroll()
+
+	for _, row := range p.Rows() {
+		var rep *RowRepeat
+
+		body := row.Nodes
+
+		for i, node := range body {
+			if tt, ok := node.(*RowRepeat); ok {
+				if i < len(body)-1 {
+					next := body[i+1]
+					return fmt.Errorf("UnrollRows %q: %d:%d Expected Row after row repeat, found %T.",
+						p.Name, next.Line(), next.Col(), next)
+				}
+
+				rep = tt
+				body = body[:i]
+			}
+		}
+
+		if row.Row == nil {
+			nodes = append(nodes, body...)
+		} else {
+			from, to := row.Row.Value, row.Row.To
+
+			if to < from {
+				to = from
+			}
+
+			for n := from; n <= to; n++ {
+				r := *row.Row
+				r.Value, r.To = n, 0
+
+				if n > from {
+					r.Side = UnknownSide
+				}
+
+				nodes = append(nodes, &r)
+				nodes = append(nodes, copyNodes(body)...)
+
+				if n > 0 {
+					defined[n] = &RowData{Row: &r, Nodes: body}
+				}
+			}
+
+			if to > last {
+				last = to
+			}
+		}
+
+		if rep == nil {
+			continue
+		}
+
+		if rep.Until > 0 {
+			return fmt.Errorf("UnrollRows %q: %d:%d Unresolved length %q.",
+				p.Name, rep.line, rep.col, rep)
+		}
+
+		var block []*RowData
+
+		for n := rep.From; n <= rep.To; n++ {
+			def, ok := defined[n]
+
+			if !ok {
+				return fmt.Errorf("UnrollRows %q: %d:%d Row %d is not defined.",
+					p.Name, rep.line, rep.col, n)
+			}
+
+			block = append(block, def)
+		}
+
+		for k := 0; k < rep.Count; k++ {
+			for _, def := range block {
+				last++
+
+				r := *def.Row
+				r.Value = last
+
+				nodes = append(nodes, &r)
+				nodes = append(nodes, copyNodes(def.Nodes)...)
+				defined[last] = &RowData{Row: &r, Nodes: def.Nodes}
+			}
+		}
+	}
+
+	p.SetNodes(nodes)
+	return nil
+}
+
+// ResolveLengths turns every row repeat bounded by a length into a fixed
+// number of repeats, using the row gauge. E.g.: `Rep Rows 1-4 until 30cm`.
+//
+// The length is measured from the cast-on edge: every row worked before
+// the repeat counts towards it, including repeated blocks and row ranges.
+// The block is repeated until the piece reaches at least the given length.
+// Only complete blocks are worked, so the piece can end up slightly longer.
+// A repeat which is not needed, because the piece is long enough already,
+// is removed.
+//
+// Nested rows are unrolled first.
+func (p *Pattern) ResolveLengths(g Gauge) error {
+	var worked int
+
+	if err := g.Validate(); err != nil {
+		return fmt.Errorf("ResolveLengths %q: %v", p.Name, err)
+	}
+
+	p.Unroll()
+
+	for _, row := range p.Rows() {
+		switch {
+		case row.Row == nil && len(row.Nodes) == 0:
+		case row.Row == nil || row.Row.To <= row.Row.Value:
+			worked++
+		default:
+			worked += row.Row.To - row.Row.Value + 1
+		}
+
+		for _, node := range row.Nodes {
+			rr, ok := node.(*RowRepeat)
+
+			if !ok {
+				continue
+			}
+
+			block := rr.To - rr.From + 1
+
+			if rr.Until > 0 {
+				want := int(math.Ceil(rr.Until * g.RowsPer(rr.Unit)))
+				rr.Count = 0
+
+				if want > worked {
+					rr.Count = (want - worked + block - 1) / block
+				}
+
+				rr.Until = 0
+			}
+
+			worked += rr.Count * block
+		}
+	}
+
+	// A repeat count of 0 can not be written, so unneeded repeats go.
+	var nodes []Node
+
+	for _, node := range p.Nodes() {
+		if rr, ok := node.(*RowRepeat); !ok || rr.Count > 0 {
+			nodes = append(nodes, node)
+		}
+	}
+
+	p.SetNodes(nodes)
+	return nil
+}
+
+// copyNodes returns copies of the given nodes.
+func copyNodes(nodes []Node) []Node {
+	list := make([]Node, len(nodes))
+
+	for i, node := range nodes {
+		list[i] = copyNode(node)
+	}
+
+	return list
+}
@@ -0,0 +1,179 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRowRanges(t *testing.T) {
+	p, err := Parse("Ranges", `Row 1 RS: Co8
+		Rows 2-4: [K2 P2] 2
+		Rep Rows 3-4 2
+		Row 9: Bo8`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Row1 RS: Co8 \nRows2-4: [K2 P2]2 \nRep Rows 3-4 2 \nRow9: Bo8"
+
+	if have := p.String(); have != want {
+		t.Fatalf("String:\nWant: %q\nHave: %q", want, have)
+	}
+
+	if have := MustParse("Ranges", want).String(); have != want {
+		t.Fatalf("Round trip:\nWant: %q\nHave: %q", want, have)
+	}
+
+	q := p.Copy()
+
+	if err = q.UnrollRows(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := q.Rows()
+
+	if len(rows) != 9 {
+		t.Fatalf("Want 9 rows, have %d", len(rows))
+	}
+
+	for i, row := range rows {
+		if row.Row.Value != i+1 {
+			t.Fatalf("Row %d: Have number %d", i+1, row.Row.Value)
+		}
+
+		if i > 0 && i < 8 && row.Stitches() != 8 {
+			t.Fatalf("Row %d: Want 8 stitches, have %d", i+1, row.Stitches())
+		}
+	}
+
+	if rows[6].Side != RightSide || rows[7].Side != WrongSide {
+		t.Fatalf("Expected rows 7 and 8 on the RS and WS, have %s and %s",
+			rows[6].Side, rows[7].Side)
+	}
+
+	// Scaling affects the row repeat count, not the row range.
+	q = p.Copy()
+	q.Scale(1, 2)
+
+	want = "Row1 RS: Co8 \nRows2-4: [K2 P2]2 \nRep Rows 3-4 4 \nRow9: Bo8"
+
+	if have := q.String(); have != want {
+		t.Fatalf("Scale:\nWant: %q\nHave: %q", want, have)
+	}
+
+	for _, pat := range []string{"Rows 4-2: K", "Rep Rows 1-2", "Rep Row 1 K", "Rows 1-: K", "Rep Rows 1-2 0"} {
+		if _, err = Parse("Invalid", pat); err == nil {
+			t.Fatalf("Parse %q: Expected an error", pat)
+		}
+	}
+
+	err = MustParse("Undefined", "Row 1: Co4\nRep Rows 1-2 1").UnrollRows()
+
+	if err == nil {
+		t.Fatal("UnrollRows: Expected undefined row error")
+	}
+
+	// Without a row number to follow, these words are references.
+	for pat, i := range map[string]int{
+		"Rep K":            0,
+		"Row 1: K2 Rep P2": 3,
+		"Row 1: K Rows":    2,
+		"Rounds K":         0,
+	} {
+		p = MustParse("References", pat)
+
+		if _, ok := p.Node(i).(*Reference); !ok {
+			t.Fatalf("%q: Node %d: Want a reference, have %T", pat, i, p.Node(i))
+		}
+	}
+}
+
+func TestResolveLengths(t *testing.T) {
+	p, err := Parse("Lengths", `Row 1: Co20
+		Rows 2-5: [K2 P2] 5
+		Rep Rows 2-5 until 7.5cm
+		Row: Bo20`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := strings.TrimSpace(strings.Split(p.String(), "\n")[2]); have != "Rep Rows 2-5 until 7.5cm" {
+		t.Fatalf("String: Have %q", have)
+	}
+
+	if err = p.Copy().UnrollRows(); err == nil {
+		t.Fatal("UnrollRows: Expected unresolved length error")
+	}
+
+	// Scaling leaves a length alone.
+	q := p.Copy()
+	q.Scale(1, 2)
+
+	if have, want := q.String(), p.String(); have != want {
+		t.Fatalf("Scale:\nWant: %q\nHave: %q", want, have)
+	}
+
+	// 7.5cm at 20 rows per 10cm takes 15 rows. The first 5 rows are
+	// followed by 3 more blocks of 4 rows, for a total of 17 rows.
+	if err = p.ResolveLengths(Gauge{Stitches: 22, Rows: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := p.StitchCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(counts) != 18 {
+		t.Fatalf("Want 18 rows, have %d", len(counts))
+	}
+
+	for _, pat := range []string{
+		"Rep Rows 1-4 until cm",
+		"Rep Rows 1-4 until 0cm",
+		"Rep Rows 1-4 until 3 m",
+		"Rows 1-4: K until 3cm",
+		"K 3in",
+	} {
+		if _, err = Parse("Invalid", pat); err == nil {
+			t.Fatalf("Parse %q: Expected an error", pat)
+		}
+	}
+
+	// A repeat is dropped if the piece is long enough without it.
+	p = MustParse("Short", "Row 1: Co20\nRows 2-5: K20\nRep Rows 2-5 until 1cm\nRow: Bo20")
+
+	if err = p.ResolveLengths(Gauge{Stitches: 22, Rows: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(p.String(), "Rep") {
+		t.Fatalf("ResolveLengths: Unneeded repeat kept:\n%s", p)
+	}
+
+	if have := len(p.Rows()); have != 3 {
+		t.Fatalf("ResolveLengths: Want 3 rows, have %d", have)
+	}
+
+	if _, err = Parse("Short", p.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	// At the start of a row, `until` is a reference. So is a unit which
+	// does not follow a number.
+	for pat, i := range map[string]int{
+		"Row 1: Until 2": 1,
+		"Row 1: K2 P cm": 4,
+	} {
+		p = MustParse("References", pat)
+
+		if _, ok := p.Node(i).(*Reference); !ok {
+			t.Fatalf("%q: Node %d: Want a reference, have %T", pat, i, p.Node(i))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+// RowData holds the nodes which make up a single row of a pattern.
+type RowData struct {
+	Row   *Row   // Row node starting the row. Nil for nodes preceding the first Row.
+	Nodes []Node // Pattern nodes belonging to the row.
+	Side  Side   // Side of the work facing the knitter.
+	Round bool   // Is the row worked in the round?
+	Short bool   // Does the row end at a turn, leaving stitches unworked?
+}
+
+// Direction returns the direction in which the row is worked,
+// as seen from the right side of the work.
+func (r *RowData) Direction() Direction {
+	if r.Side == WrongSide {
+		return LeftToRight
+	}
+
+	return RightToLeft
+}
+
+// Public returns the stitch kind, as it appears on the right side of
+// the work. For example, a knit stitch on a wrong side row appears as
+// a purl stitch on the right side.
+func (r *RowData) Public(k StitchKind) StitchKind {
+	if r.Side == WrongSide {
+		return k.Opposite()
+	}
+
+	return k
+}
+
+// Stitches returns the number of Stitch nodes in the row.
+// Nested groups and quantifiers are not considered, so this
+// is only accurate for unrolled patterns.
+func (r *RowData) Stitches() int {
+	var n int
+
+	for _, node := range r.Nodes {
+		if _, ok := node.(*Stitch); ok {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Rows splits the top-level pattern nodes into rows.
+//
+// Rows nested inside groups are not split, as they are repeated as part
+// of the group. Call Pattern.Unroll first to get a complete row listing.
+//
+// The side of each row is resolved as follows: rounds are always worked
+// from the right side. Flat rows use their explicit side annotation if
+// they have one. Otherwise they alternate sides with the previous row,
+// starting at the right side.
+func (p *Pattern) Rows() []*RowData {
+	var list []*RowData
+	var row *RowData
+
+	side := WrongSide
+
+	for _, node := range p.Nodes() {
+		if tt, ok := node.(*Row); ok {
+			switch {
+			case tt.Round:
+				side = RightSide
+			case tt.Side != UnknownSide:
+				side = tt.Side
+			default:
+				side = side.Opposite()
+			}
+
+			row = &RowData{Row: tt, Side: side, Round: tt.Round}
+			list = append(list, row)
+			continue
+		}
+
+		if row == nil {
+			side = RightSide
+			row = &RowData{Side: side}
+			list = append(list, row)
+		}
+
+		row.Nodes = append(row.Nodes, node)
+		row.Short = row.Short || isTurn(node)
+	}
+
+	return list
+}
@@ -3,56 +3,17 @@
 
 package knit
 
-import (
-	"fmt"
-	"strings"
-)
-
-// Listing of builtin stitch types.
-var stitches map[string]StitchKind
-
-func init() {
-	stitches = make(map[string]StitchKind)
-	stitches["inc"] = Increase
-	stitches["dec"] = Decrease
-	stitches["tog"] = Decrease
-	stitches["yo"] = YarnOver
-	stitches["ks"] = KnitSlip
-	stitches["ps"] = PurlSlip
-	stitches["co"] = CastOn
-	stitches["bo"] = BindOff
-	stitches["k"] = KnitStitch
-	stitches["p"] = PurlStitch
-	stitches["p2tog"] = P2Tog
-	stitches["p3tog"] = P3Tog
-	stitches["p4tog"] = P4Tog
-	stitches["k2tog"] = K2Tog
-	stitches["k3tog"] = K3Tog
-	stitches["k4tog"] = K4Tog
-	stitches["ca"] = Cable
-	stitches["psso"] = PassOver
-	stitches["ssk"] = SlipSlipKnit
-	stitches["ssp"] = SlipSlipPurl
-}
-
-// getStitchKind returns the kind of stitch represented by the
-// supplied string.
-func getStitchKind(s string) StitchKind {
-	for k, v := range stitches {
-		if strings.EqualFold(k, s) {
-			return v
-		}
-	}
-
-	return UnknownStitch
-}
+import "fmt"
 
 // A stich defines a specific kind of stitch to perform.
 type Stitch struct {
-	line int
-	col  int
-	Kind StitchKind // Type of stitch.
-	Mod  StitchMod  // Stitch modifier.
+	line  int
+	col   int
+	Kind  StitchKind // Type of stitch.
+	Mod   StitchMod  // Stitch modifier.
+	Color string     // Colour name; empty for the default colour.
+	Def   *StitchDef // Definition of a custom stitch kind; nil for builtin kinds.
+	reps  []Repeat   // Repeats this stitch was unrolled from, outermost first.
 }
 
 // Line returns the original pattern source line number for this node.
@@ -61,10 +22,46 @@ func (s *Stitch) Line() int { return s.line }
 // Col returns the original pattern source column number for this node.
 func (s *Stitch) Col() int { return s.col }
 
+// Name returns the stitch name as it is written in a pattern.
+func (s *Stitch) Name() string {
+	if s.Def != nil {
+		return s.Def.Name
+	}
+
+	return s.Kind.String()
+}
+
+// Consumes returns the number of live stitches this stitch works
+// off the left needle. A stitch worked into the same stitch as the
+// previous one consumes one stitch less.
+func (s *Stitch) Consumes() int {
+	n := s.Kind.Consumes()
+
+	if s.Def != nil {
+		n = s.Def.Consumes
+	}
+
+	if s.Mod&SameStitch != 0 && n > 0 {
+		n--
+	}
+
+	return n
+}
+
+// Produces returns the number of new stitches this stitch leaves
+// on the right needle.
+func (s *Stitch) Produces() int {
+	if s.Def != nil {
+		return s.Def.Produces
+	}
+
+	return s.Kind.Produces()
+}
+
 func (s *Stitch) String() string {
 	if s.Mod == 0 {
-		return s.Kind.String()
+		return s.Name()
 	}
 
-	return fmt.Sprintf("%s%s", s.Mod, s.Kind)
+	return fmt.Sprintf("%s%s", s.Mod, s.Name())
 }
@@ -0,0 +1,44 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import "testing"
+
+func TestStitchNames(t *testing.T) {
+	p, err := Parse("Names", "k2tog P4TOG s2kp cdd yo2 yo3 w&t m1 m1r kfb2 pfb sk2p yo2 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "K2Tog P4Tog S2kp S2kp Yo2 Yo3 W&t M1L M1R Kfb2 Pfb Sk2p Yo2 3"
+
+	if have := p.String(); have != want {
+		t.Fatalf("String: Want %q, have %q", want, have)
+	}
+
+	// A quantifier following a name which ends in a digit is kept apart.
+	if have := MustParse("Names", want).String(); have != want {
+		t.Fatalf("String: Want %q, have %q", want, have)
+	}
+
+	counts := []struct {
+		kind     StitchKind
+		consumes int
+		produces int
+	}{
+		{K2Tog, 2, 1},
+		{S2kp, 3, 1},
+		{DoubleYarnOver, 0, 2},
+		{KnitFrontBack, 1, 2},
+		{MakeOneRight, 0, 1},
+		{WrapTurn, 0, 0},
+	}
+
+	for _, c := range counts {
+		if c.kind.Consumes() != c.consumes || c.kind.Produces() != c.produces {
+			t.Fatalf("%s: Want %d/%d, have %d/%d", c.kind, c.consumes,
+				c.produces, c.kind.Consumes(), c.kind.Produces())
+		}
+	}
+}
@@ -3,6 +3,8 @@
 
 package knit
 
+import "fmt"
+
 type StitchKind uint8
 
 // Known stitch kinds.
@@ -27,6 +29,19 @@ const (
 	PassOver
 	SlipSlipKnit
 	SlipSlipPurl
+	LeftCross
+	RightCross
+	LeftLiftedInc
+	RightLiftedInc
+	MakeOneLeft
+	MakeOneRight
+	KnitFrontBack
+	PurlFrontBack
+	S2kp
+	Sk2p
+	DoubleYarnOver
+	WrapTurn
+	DoubleStitch
 )
 
 // String returns the string equivalent of the given stitch kind.
@@ -63,7 +78,7 @@ func (k StitchKind) String() string {
 	case P3Tog:
 		return "P3Tog"
 	case P4Tog:
-		return "K4Tog"
+		return "P4Tog"
 	case Cable:
 		return "Ca"
 	case PassOver:
@@ -72,7 +87,146 @@ func (k StitchKind) String() string {
 		return "Ssk"
 	case SlipSlipPurl:
 		return "Ssp"
+	case LeftCross:
+		return "Lc"
+	case RightCross:
+		return "Rc"
+	case LeftLiftedInc:
+		return "Lli"
+	case RightLiftedInc:
+		return "Rli"
+	case MakeOneLeft:
+		return "M1L"
+	case MakeOneRight:
+		return "M1R"
+	case KnitFrontBack:
+		return "Kfb"
+	case PurlFrontBack:
+		return "Pfb"
+	case S2kp:
+		return "S2kp"
+	case Sk2p:
+		return "Sk2p"
+	case DoubleYarnOver:
+		return "Yo2"
+	case WrapTurn:
+		return "W&t"
+	case DoubleStitch:
+		return "Ds"
+	}
+
+	if k >= FirstCustomStitch {
+		return fmt.Sprintf("Custom%d", k-FirstCustomStitch)
 	}
 
 	panic("unreachable")
 }
+
+// Consumes returns the number of live stitches a stitch of this kind
+// works off the left needle.
+//
+// PassOver does not work a stitch off the left needle. It lifts a stitch
+// which has already been worked over another one, so it consumes nothing.
+// WrapTurn leaves its wrapped stitch on the left needle, so it consumes
+// nothing either.
+func (k StitchKind) Consumes() int {
+	switch k {
+	case CastOn, YarnOver, LeftLiftedInc, RightLiftedInc, MakeOneLeft,
+		MakeOneRight, DoubleYarnOver, WrapTurn, PassOver:
+		return 0
+	case Decrease, K2Tog, P2Tog, SlipSlipKnit, SlipSlipPurl, LeftCross, RightCross:
+		return 2
+	case K3Tog, P3Tog, S2kp, Sk2p:
+		return 3
+	case K4Tog, P4Tog:
+		return 4
+	}
+
+	return 1
+}
+
+// Produces returns the number of new stitches a stitch of this kind
+// leaves on the right needle. This is -1 for PassOver, as it takes a
+// stitch off the right needle. Summing the counts of the stitches in a
+// row therefore yields the row's stitch counts.
+func (k StitchKind) Produces() int {
+	switch k {
+	case PassOver:
+		return -1
+	case BindOff, WrapTurn:
+		return 0
+	case Increase, LeftCross, RightCross, KnitFrontBack, PurlFrontBack, DoubleYarnOver:
+		return 2
+	}
+
+	return 1
+}
+
+// Opposite returns the stitch kind which yields the same result when
+// worked from the opposite side of the work. A knit stitch worked on the
+// wrong side shows up as a purl stitch on the right side and vice versa.
+// Kinds without a counterpart are returned unchanged.
+func (k StitchKind) Opposite() StitchKind {
+	switch k {
+	case KnitStitch:
+		return PurlStitch
+	case PurlStitch:
+		return KnitStitch
+	case K2Tog:
+		return P2Tog
+	case K3Tog:
+		return P3Tog
+	case K4Tog:
+		return P4Tog
+	case P2Tog:
+		return K2Tog
+	case P3Tog:
+		return K3Tog
+	case P4Tog:
+		return K4Tog
+	case SlipSlipKnit:
+		return SlipSlipPurl
+	case SlipSlipPurl:
+		return SlipSlipKnit
+	case KnitFrontBack:
+		return PurlFrontBack
+	case PurlFrontBack:
+		return KnitFrontBack
+	}
+
+	return k
+}
+
+// Mirror returns the stitch kind which leans or crosses in the opposite
+// direction. For example, a K2Tog leans right and an Ssk leans left.
+// Kinds without a direction are returned unchanged.
+func (k StitchKind) Mirror() StitchKind {
+	switch k {
+	case K2Tog:
+		return SlipSlipKnit
+	case SlipSlipKnit:
+		return K2Tog
+	case P2Tog:
+		return SlipSlipPurl
+	case SlipSlipPurl:
+		return P2Tog
+	case LeftCross:
+		return RightCross
+	case RightCross:
+		return LeftCross
+	case LeftLiftedInc:
+		return RightLiftedInc
+	case RightLiftedInc:
+		return LeftLiftedInc
+	case MakeOneLeft:
+		return MakeOneRight
+	case MakeOneRight:
+		return MakeOneLeft
+	case K3Tog:
+		return Sk2p
+	case Sk2p:
+		return K3Tog
+	}
+
+	return k
+}
@@ -12,27 +12,56 @@ const (
 	DeepKnit
 	YarnForward
 	YarnBackward
+	SameStitch // Work into the same stitch as the previous one.
 )
 
 func (m StitchMod) String() string {
-	switch m {
-	case BackLoop:
-		return "@"
-	case DeepKnit:
-		return "^"
-	case YarnForward:
-		return ">"
-	case YarnBackward:
-		return "<"
-	}
-
-	panic("unreachable")
+	var s string
+
+	if m&BackLoop != 0 {
+		s += "@"
+	}
+
+	if m&DeepKnit != 0 {
+		s += "^"
+	}
+
+	if m&YarnForward != 0 {
+		s += ">"
+	}
+
+	if m&YarnBackward != 0 {
+		s += "<"
+	}
+
+	if m&SameStitch != 0 {
+		s += "&"
+	}
+
+	return s
+}
+
+// Opposite returns the modifiers with the same meaning when worked from
+// the opposite side of the work. Yarn forward becomes yarn backward and
+// vice versa.
+func (m StitchMod) Opposite() StitchMod {
+	out := m &^ (YarnForward | YarnBackward)
+
+	if m&YarnForward != 0 {
+		out |= YarnBackward
+	}
+
+	if m&YarnBackward != 0 {
+		out |= YarnForward
+	}
+
+	return out
 }
 
 // isMod returns true if the given byte represents a known modifier.
 func isMod(b byte) bool {
 	switch b {
-	case '@', '^', '<', '>':
+	case '@', '^', '<', '>', '&':
 		return true
 	}
 
@@ -50,6 +79,8 @@ func getModKind(v string) StitchMod {
 		return YarnForward
 	case "<":
 		return YarnBackward
+	case "&":
+		return SameStitch
 	}
 
 	return 0
@@ -3,6 +3,8 @@
 
 package knit
 
+import "strings"
+
 type tokenType uint8
 
 // Known token types.
@@ -16,6 +18,19 @@ const (
 	tokGroupStart
 	tokGroupEnd
 	tokRow
+	tokColor
+	tokSide
+	tokTurn
+	tokMarker
+	tokTo
+	tokBefore
+	tokSts
+	tokTarget
+	tokParam
+	tokRange
+	tokRepeat
+	tokUntil
+	tokUnit
 )
 
 func (t tokenType) String() string {
@@ -38,11 +53,126 @@ func (t tokenType) String() string {
 		return "GROUPE"
 	case tokRow:
 		return "ROW"
+	case tokColor:
+		return "COLOR"
+	case tokSide:
+		return "SIDE"
+	case tokTurn:
+		return "TURN"
+	case tokMarker:
+		return "MARKER"
+	case tokTo:
+		return "TO"
+	case tokBefore:
+		return "BEFORE"
+	case tokSts:
+		return "STS"
+	case tokTarget:
+		return "TARGET"
+	case tokParam:
+		return "PARAM"
+	case tokRange:
+		return "RANGE"
+	case tokRepeat:
+		return "REPEAT"
+	case tokUntil:
+		return "UNTIL"
+	case tokUnit:
+		return "UNIT"
 	}
 
 	panic("unreachable")
 }
 
+// keywords maps reserved words onto the token types they produce.
+// Refer to inContext for the places where they are keywords.
+var keywords = map[string]tokenType{
+	"row":    tokRow,
+	"rnd":    tokRow,
+	"round":  tokRow,
+	"rows":   tokRow,
+	"rnds":   tokRow,
+	"rounds": tokRow,
+	"rep":    tokRepeat,
+	"repeat": tokRepeat,
+	"rs":     tokSide,
+	"ws":     tokSide,
+	"turn":   tokTurn,
+	"pm":     tokMarker,
+	"sm":     tokMarker,
+	"rm":     tokMarker,
+	"to":     tokTo,
+	"before": tokBefore,
+	"st":     tokSts,
+	"sts":    tokSts,
+	"m":      tokTarget,
+	"end":    tokTarget,
+	"until":  tokUntil,
+	"cm":     tokUnit,
+	"in":     tokUnit,
+	"inch":   tokUnit,
+	"inches": tokUnit,
+}
+
+// inContext returns true if the given keyword token can appear at the
+// end of the given group, which is the one being read. Anywhere else,
+// the parser reads the word as a reference, like any other unknown word.
+//
+// `RS` and `WS` only follow a row header. `Turn` and `to` follow the work
+// of a row, so they never start a pattern, row or group. Markers never
+// start a pattern. `before`, `st`, `sts`, `m` and `end` only continue a
+// repeat up to a marker. `Rows`, `Rnds` and `Rounds` must be followed by
+// a row number and `Rep` by a row header, which the upcoming tokens tell.
+// `until` follows the rows of a row repeat or the work of a row. A unit
+// follows the length of a measured row repeat, or any other number.
+//
+// The flags tell whether a repeat up to a marker, a row repeat or the
+// length of a measured row repeat is pending.
+func inContext(tok *token, node *Group, ahead *lookahead, repeat, repeating, measure bool) bool {
+	last := node.Node(node.Len() - 1)
+	_, row := last.(*Row)
+
+	switch tok.Type {
+	case tokRow:
+		return !isPlural(tok.Data) || isType(ahead.peek(0), tokNumber)
+	case tokRepeat:
+		return isType(ahead.peek(0), tokRow) && isType(ahead.peek(1), tokNumber)
+	case tokSide:
+		return row
+	case tokTurn, tokTo:
+		return last != nil && !row
+	case tokMarker:
+		return last != nil || node.Parent() != nil
+	case tokBefore, tokSts, tokTarget:
+		return repeat
+	case tokUntil:
+		return repeating || (last != nil && !row)
+	case tokUnit:
+		_, number := last.(*Number)
+		return measure || number
+	}
+
+	return true
+}
+
+// isReserved returns true if v is a keyword wherever it appears, so that
+// it can not be used as a reference.
+func isReserved(v string) bool {
+	tt, ok := keywords[strings.ToLower(v)]
+	return ok && tt == tokRow && !isPlural(v)
+}
+
+// isPlural returns true if the given row keyword is a plural.
+// E.g.: `Rows`.
+func isPlural(v string) bool {
+	return strings.HasSuffix(strings.ToLower(v), "s")
+}
+
+// isType returns true if tok is a token of the given type.
+func isType(tok *token, tt tokenType) bool {
+	return tok != nil && tok.Type == tt
+}
+
 // A token represents a single parsed pattern token.
 type token struct {
 	Type tokenType
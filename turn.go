@@ -0,0 +1,33 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+// A Turn marks the point at which a short row ends. The work is turned
+// and the next row starts from here, leaving the remaining stitches of
+// the row unworked.
+//
+// The W&t stitch implies a turn. German short rows use a plain Turn,
+// followed by a Ds (double stitch) at the start of the next row.
+type Turn struct {
+	line int
+	col  int
+}
+
+// Line returns the original pattern source line number for this node.
+func (t *Turn) Line() int { return t.line }
+
+// Col returns the original pattern source column number for this node.
+func (t *Turn) Col() int { return t.col }
+
+// isTurn returns true if the given node ends a short row.
+func isTurn(node Node) bool {
+	switch tt := node.(type) {
+	case *Turn:
+		return true
+	case *Stitch:
+		return tt.Kind == WrapTurn
+	}
+
+	return false
+}
@@ -0,0 +1,309 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// MetersPerYard is the number of meters in a yard.
+const MetersPerYard = 0.9144
+
+// YarnWeight defines the standard yarn weight categories.
+type YarnWeight uint8
+
+// Known yarn weights.
+const (
+	UnknownWeight YarnWeight = iota
+	Lace
+	Fingering
+	Sport
+	DK
+	Worsted
+	Bulky
+	SuperBulky
+	Jumbo
+)
+
+// String returns the name of the given yarn weight.
+func (w YarnWeight) String() string {
+	switch w {
+	case UnknownWeight:
+		return "Unknown"
+	case Lace:
+		return "Lace"
+	case Fingering:
+		return "Fingering"
+	case Sport:
+		return "Sport"
+	case DK:
+		return "DK"
+	case Worsted:
+		return "Worsted"
+	case Bulky:
+		return "Bulky"
+	case SuperBulky:
+		return "Super Bulky"
+	case Jumbo:
+		return "Jumbo"
+	}
+
+	panic("unreachable")
+}
+
+// MarshalText returns the name of the yarn weight.
+func (w YarnWeight) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+// UnmarshalText sets the yarn weight from its name.
+func (w *YarnWeight) UnmarshalText(data []byte) error {
+	v, ok := getYarnWeight(string(data))
+
+	if !ok && !strings.EqualFold(string(data), UnknownWeight.String()) {
+		return fmt.Errorf("Unknown yarn weight %q.", data)
+	}
+
+	*w = v
+	return nil
+}
+
+// getYarnWeight returns the yarn weight with the given name.
+// The lookup is case insensitive.
+func getYarnWeight(v string) (YarnWeight, bool) {
+	for w := Lace; w <= Jumbo; w++ {
+		if strings.EqualFold(w.String(), v) {
+			return w, true
+		}
+	}
+
+	return UnknownWeight, false
+}
+
+// typicalStitches returns the customary number of stockinette stitches
+// per 10cm for the given yarn weight, or 0 if it is not known.
+func (w YarnWeight) typicalStitches() float64 {
+	switch w {
+	case Lace:
+		return 33
+	case Fingering:
+		return 28
+	case Sport:
+		return 24
+	case DK:
+		return 22
+	case Worsted:
+		return 18
+	case Bulky:
+		return 14
+	case SuperBulky:
+		return 9
+	case Jumbo:
+		return 6
+	}
+
+	return 0
+}
+
+// consumption lists the default yarn consumption per stitch kind,
+// relative to that of a single knit stitch.
+var consumption = map[StitchKind]float64{
+	KnitStitch:     1,
+	PurlStitch:     1.05,
+	KnitSlip:       0.35,
+	PurlSlip:       0.35,
+	CastOn:         1.5,
+	BindOff:        1.2,
+	Increase:       2,
+	Decrease:       1.1,
+	YarnOver:       0.7,
+	K2Tog:          1.1,
+	K3Tog:          1.2,
+	K4Tog:          1.3,
+	P2Tog:          1.15,
+	P3Tog:          1.25,
+	P4Tog:          1.35,
+	Cable:          1.2,
+	PassOver:       0,
+	SlipSlipKnit:   1.15,
+	SlipSlipPurl:   1.2,
+	LeftCross:      2.3,
+	RightCross:     2.3,
+	LeftLiftedInc:  1,
+	RightLiftedInc: 1,
+	MakeOneLeft:    1,
+	MakeOneRight:   1,
+	KnitFrontBack:  2,
+	PurlFrontBack:  2.1,
+	S2kp:           1.2,
+	Sk2p:           1.25,
+	DoubleYarnOver: 1.4,
+	WrapTurn:       0.3,
+	DoubleStitch:   1.1,
+}
+
+// A Swatch describes a measured stockinette swatch. It is used to
+// calibrate yarn estimates.
+type Swatch struct {
+	Stitches int     // Number of stitches across the swatch.
+	Rows     int     // Number of rows along the swatch.
+	Meters   float64 // Yarn used to knit the swatch, in meters.
+}
+
+// Yarn defines the yarn and gauge a pattern is knitted with.
+// It is used to estimate yarn consumption.
+type Yarn struct {
+	Weight YarnWeight // Weight category of the yarn. Optional.
+	Gauge  Gauge      // Gauge the pattern is knitted at.
+
+	// Swatch optionally calibrates the length of yarn used by a single
+	// knit stitch. If it is set, Weight is ignored.
+	Swatch *Swatch
+
+	// Consumption optionally overrides the yarn consumption for specific
+	// stitch kinds, relative to that of a single knit stitch.
+	Consumption map[StitchKind]float64
+}
+
+// stitchLength returns the estimated length of yarn, in meters,
+// used by a single knit stitch.
+//
+// Without a swatch, this approximates the path of the yarn through
+// a stitch as its width plus twice its height. The yarn weight
+// adjusts for yarn which is knitted tighter or looser than usual.
+func (y *Yarn) stitchLength() (float64, error) {
+	if y.Swatch != nil {
+		s := y.Swatch
+
+		if s.Stitches <= 0 || s.Rows <= 0 || s.Meters <= 0 {
+			return 0, fmt.Errorf("Invalid swatch %d sts x %d rows, %gm.",
+				s.Stitches, s.Rows, s.Meters)
+		}
+
+		return s.Meters / float64(s.Stitches*s.Rows), nil
+	}
+
+	if err := y.Gauge.Validate(); err != nil {
+		return 0, err
+	}
+
+	sts := y.Gauge.StitchesPer(Centimeter)
+	width := 1 / sts
+	height := 1 / y.Gauge.RowsPer(Centimeter)
+	length := 1.2 * (width + 2*height) / 100
+
+	if typical := y.Weight.typicalStitches(); typical > 0 {
+		length *= math.Sqrt(sts * 10 / typical)
+	}
+
+	return length, nil
+}
+
+// consumption returns the relative yarn consumption for the given stitch.
+// Custom stitches default to that of a knit stitch for every stitch
+// they produce.
+func (y *Yarn) consumption(st *Stitch) float64 {
+	if v, ok := y.Consumption[st.Kind]; ok {
+		return v
+	}
+
+	if v, ok := consumption[st.Kind]; ok {
+		return v
+	}
+
+	return math.Max(1, float64(st.Produces()))
+}
+
+// RowUsage holds the estimated yarn consumption for a single row.
+type RowUsage struct {
+	Row      *Row    // Row node for this row. Nil for stitches preceding the first row.
+	Stitches int     // Number of stitches worked in the row.
+	Meters   float64 // Yarn used, in meters.
+}
+
+// Yards returns the yarn used in the row, in yards.
+func (r *RowUsage) Yards() float64 { return r.Meters / MetersPerYard }
+
+// YarnUsage holds the estimated yarn consumption of a pattern.
+type YarnUsage struct {
+	Rows   []*RowUsage // Consumption per row, in order of appearance.
+	Meters float64     // Total yarn used, in meters.
+}
+
+// Yards returns the total yarn used, in yards.
+func (u *YarnUsage) Yards() float64 { return u.Meters / MetersPerYard }
+
+// Skeins returns the number of skeins needed, given the length of
+// a single skein in meters.
+func (u *YarnUsage) Skeins(meters float64) int {
+	if meters <= 0 {
+		return 0
+	}
+
+	return int(math.Ceil(u.Meters / meters))
+}
+
+// YarnUsage estimates the yarn consumed by knitting the pattern with
+// the given yarn.
+//
+// If the yarn has no gauge or weight, those from the pattern header are
+// used. y may be nil if the header declares a gauge.
+func (p *Pattern) YarnUsage(y *Yarn) (*YarnUsage, error) {
+	y = p.yarn(y)
+	length, err := y.stitchLength()
+
+	if err != nil {
+		return nil, fmt.Errorf("YarnUsage %q: %v", p.Name, err)
+	}
+
+	q, err := p.Unrolled()
+
+	if err != nil {
+		return nil, fmt.Errorf("YarnUsage %q: %v", p.Name, err)
+	}
+
+	u := new(YarnUsage)
+
+	for _, row := range q.Rows() {
+		ru := &RowUsage{Row: row.Row}
+
+		for _, node := range row.Nodes {
+			if tt, ok := node.(*Stitch); ok {
+				ru.Stitches++
+				ru.Meters += length * y.consumption(tt)
+			}
+		}
+
+		u.Rows = append(u.Rows, ru)
+		u.Meters += ru.Meters
+	}
+
+	return u, nil
+}
+
+// yarn returns a copy of y, with its gauge and weight defaulting to those
+// declared in the pattern header. y may be nil.
+func (p *Pattern) yarn(y *Yarn) *Yarn {
+	var c Yarn
+
+	if y != nil {
+		c = *y
+	}
+
+	if p.Meta == nil {
+		return &c
+	}
+
+	if c.Gauge == (Gauge{}) && p.Meta.Gauge != nil {
+		c.Gauge = *p.Meta.Gauge
+	}
+
+	if c.Weight == UnknownWeight {
+		c.Weight = p.Meta.Yarn
+	}
+
+	return &c
+}
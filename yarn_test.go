@@ -0,0 +1,41 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package knit
+
+import (
+	"math"
+	"testing"
+)
+
+func TestYarnUsage(t *testing.T) {
+	p, err := Parse("Swatch", "[Row 1: K10 Row 2: P10] 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := p.YarnUsage(&Yarn{
+		Swatch: &Swatch{Stitches: 10, Rows: 10, Meters: 1},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(u.Rows) != 10 {
+		t.Fatalf("YarnUsage rows: Want 10, have %d", len(u.Rows))
+	}
+
+	if u.Rows[1].Stitches != 10 || math.Abs(u.Rows[1].Meters-0.105) > 1e-9 {
+		t.Fatalf("YarnUsage row 2: Want 10 sts, 0.105m, have %d sts, %gm",
+			u.Rows[1].Stitches, u.Rows[1].Meters)
+	}
+
+	if math.Abs(u.Meters-1.025) > 1e-9 {
+		t.Fatalf("YarnUsage total: Want 1.025m, have %gm", u.Meters)
+	}
+
+	if n := u.Skeins(0.5); n != 3 {
+		t.Fatalf("YarnUsage skeins: Want 3, have %d", n)
+	}
+}